@@ -1,58 +1,186 @@
 package main
 
 import (
+	"context"
+	"log"
+	"time"
+
 	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/credentials"
+	"github.com/callmemars1/ytdlp-http/internal/health"
+	"github.com/callmemars1/ytdlp-http/internal/jobs"
+	"github.com/callmemars1/ytdlp-http/internal/links"
+	"github.com/callmemars1/ytdlp-http/internal/metrics"
+	"github.com/callmemars1/ytdlp-http/internal/pipeline"
+	"github.com/callmemars1/ytdlp-http/internal/proxy"
 	"github.com/callmemars1/ytdlp-http/internal/s3"
 	"github.com/callmemars1/ytdlp-http/internal/server"
 	"github.com/callmemars1/ytdlp-http/internal/server/handlers"
 	"github.com/callmemars1/ytdlp-http/internal/server/middlewares"
+	"github.com/callmemars1/ytdlp-http/internal/subscriptions"
+	"github.com/callmemars1/ytdlp-http/internal/tracing"
+	"github.com/callmemars1/ytdlp-http/internal/transcode"
 	"github.com/callmemars1/ytdlp-http/internal/utils"
 	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
+// shutdownMargin is added on top of the configured drain period so that
+// hooks running after the HTTP server stops can still finish.
+const shutdownMargin = 30 * time.Second
+
 func main() {
+	config, err := configurations.NewConfig()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	fx.New(
+		fx.Supply(config),
+		fx.StopTimeout(config.Server.ShutdownDelay+config.Server.ShutdownTimeout+shutdownMargin),
 		fx.Provide(
-			provideConfig,
 			provideLogger,
+			provideTracing,
+			metrics.New,
+			provideProxyManager,
 			provideYtdlpService,
 			provideS3Service,
+			provideTranscodeService,
+			provideLinkService,
+			provideCredentialStore,
+			provideJobStore,
+			providePipelineService,
+			provideSubscriptionScheduler,
+			provideHealthChecker,
 			provideAuthMiddleware,
+			provideMetricsMiddleware,
 			AsHandler(handlers.NewDownloadHandler),
 			AsHandler(handlers.NewUploadHandler),
+			AsHandler(handlers.NewLinkHandler),
+			AsHandler(handlers.NewMetricsHandler),
+			AsHandler(handlers.NewHealthHandler),
+			AsHandler(handlers.NewProfilesHandler),
+			AsHandler(handlers.NewHistoryHandler),
+			AsHandler(handlers.NewBatchHandler),
+			AsHandler(handlers.NewSubscriptionHandler),
 		),
 
 		fx.Invoke(
+			// Constructed first so that its shutdown hook runs last, after
+			// draining jobs have ended their spans.
+			func(*tracing.Provider) {},
 			fx.Annotate(
 				server.RunHTTPServer,
-				fx.ParamTags(``, ``, ``, `group:"handlers"`, ``),
+				fx.ParamTags(``, ``, ``, ``, ``, `group:"handlers"`, ``, ``),
 			),
 		),
 	).Run()
 }
 
-func provideConfig() (*configurations.Config, error) {
-	return configurations.NewConfig()
-}
-
 func provideLogger() (*zap.Logger, error) {
 	return utils.NewLogger()
 }
 
-func provideYtdlpService(logger *zap.Logger) *ytdlp.Service {
-	return ytdlp.NewService(logger)
+func provideTracing(lc fx.Lifecycle, config *configurations.Config, logger *zap.Logger) (*tracing.Provider, error) {
+	provider, err := tracing.New(&config.Tracing, logger)
+	if err != nil {
+		return nil, err
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return provider.Shutdown(ctx)
+		},
+	})
+	return provider, nil
+}
+
+func provideYtdlpService(lc fx.Lifecycle, config *configurations.Config, logger *zap.Logger, m *metrics.Metrics, proxies *proxy.Manager) *ytdlp.Service {
+	service := ytdlp.NewService(&config.Ytdlp, logger, m, proxies)
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			service.StartJanitor()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return service.Shutdown(ctx)
+		},
+	})
+	return service
+}
+
+func provideProxyManager(config *configurations.Config, logger *zap.Logger) (*proxy.Manager, error) {
+	return proxy.NewManager(&config.Proxy, logger)
+}
+
+func provideS3Service(config *configurations.Config, logger *zap.Logger, m *metrics.Metrics) (*s3.Service, error) {
+	return s3.NewService(&config.S3, logger, m)
+}
+
+func provideTranscodeService(config *configurations.Config, logger *zap.Logger) (*transcode.Service, error) {
+	return transcode.NewService(&config.Transcode, logger)
 }
 
-func provideS3Service(config *configurations.Config, logger *zap.Logger) (*s3.Service, error) {
-	return s3.NewService(&config.S3, logger)
+func provideLinkService(config *configurations.Config, jobStore *jobs.Store, logger *zap.Logger) (*links.Service, error) {
+	return links.NewService(&config.Links, jobStore, logger)
 }
 
-func provideAuthMiddleware(config *configurations.Config, logger *zap.Logger) *middlewares.AuthMiddleware {
+func provideCredentialStore(config *configurations.Config, logger *zap.Logger) (*credentials.Store, error) {
+	return credentials.NewStore(&config.Credentials, logger)
+}
+
+func provideJobStore(lc fx.Lifecycle, config *configurations.Config, logger *zap.Logger) (*jobs.Store, error) {
+	store, err := jobs.NewStore(&config.Jobs, logger)
+	if err != nil {
+		return nil, err
+	}
+	lc.Append(fx.Hook{
+		OnStop: func(ctx context.Context) error {
+			return store.Close()
+		},
+	})
+	return store, nil
+}
+
+func providePipelineService(lc fx.Lifecycle, config *configurations.Config, ytdlpService *ytdlp.Service, s3Service *s3.Service, transcodeService *transcode.Service, credentialStore *credentials.Store, jobStore *jobs.Store, logger *zap.Logger) *pipeline.Service {
+	service := pipeline.NewService(&config.Jobs, ytdlpService, s3Service, transcodeService, credentialStore, jobStore, logger)
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			return service.Start(ctx)
+		},
+		OnStop: func(ctx context.Context) error {
+			return service.Shutdown(ctx)
+		},
+	})
+	return service
+}
+
+func provideSubscriptionScheduler(lc fx.Lifecycle, config *configurations.Config, jobStore *jobs.Store, ytdlpService *ytdlp.Service, pipelineService *pipeline.Service, logger *zap.Logger) *subscriptions.Scheduler {
+	scheduler := subscriptions.NewScheduler(&config.Subscriptions, jobStore, ytdlpService, pipelineService, logger)
+	lc.Append(fx.Hook{
+		OnStart: func(ctx context.Context) error {
+			scheduler.Start()
+			return nil
+		},
+		OnStop: func(ctx context.Context) error {
+			return scheduler.Shutdown(ctx)
+		},
+	})
+	return scheduler
+}
+
+func provideHealthChecker(config *configurations.Config, ytdlpService *ytdlp.Service, s3Service *s3.Service, logger *zap.Logger) *health.Checker {
+	return health.NewChecker(&config.Health, ytdlpService, s3Service, logger)
+}
+
+func provideAuthMiddleware(config *configurations.Config, logger *zap.Logger) (*middlewares.AuthMiddleware, error) {
 	return middlewares.NewAuthMiddleware(&config.Auth, logger)
 }
 
+func provideMetricsMiddleware(m *metrics.Metrics) *middlewares.MetricsMiddleware {
+	return middlewares.NewMetricsMiddleware(m)
+}
+
 func AsHandler(h any) any {
 	return fx.Annotate(
 		h,
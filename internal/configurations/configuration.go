@@ -3,31 +3,125 @@ package configurations
 import (
 	"fmt"
 	"log"
+	"time"
 
 	"github.com/spf13/viper"
 )
 
 type Config struct {
-	Server ServerConfig `mapstructure:"server"`
-	S3     S3Config     `mapstructure:"s3"`
-	Auth   AuthConfig   `mapstructure:"auth"`
+	Server      ServerConfig      `mapstructure:"server"`
+	S3          S3Config          `mapstructure:"s3"`
+	Auth        AuthConfig        `mapstructure:"auth"`
+	Links       LinksConfig       `mapstructure:"links"`
+	Metrics     MetricsConfig     `mapstructure:"metrics"`
+	Health      HealthConfig      `mapstructure:"health"`
+	Ytdlp       YtdlpConfig       `mapstructure:"ytdlp"`
+	Transcode   TranscodeConfig   `mapstructure:"transcode"`
+	Credentials CredentialsConfig `mapstructure:"credentials"`
+	Proxy       ProxyConfig       `mapstructure:"proxy"`
+	Tracing     TracingConfig     `mapstructure:"tracing"`
+	Jobs        JobsConfig        `mapstructure:"jobs"`
+
+	Subscriptions SubscriptionsConfig `mapstructure:"subscriptions"`
 }
 
 type ServerConfig struct {
-	Addr string `mapstructure:"addr"`
+	Addr            string        `mapstructure:"addr"`
+	ShutdownDelay   time.Duration `mapstructure:"shutdown_delay"`
+	ShutdownTimeout time.Duration `mapstructure:"shutdown_timeout"`
+	Debug           bool          `mapstructure:"debug"`
 }
 
 type S3Config struct {
-	AccessKeyID     string `mapstructure:"access_key_id"`
-	SecretAccessKey string `mapstructure:"secret_access_key"`
-	Region          string `mapstructure:"region"`
-	Bucket          string `mapstructure:"bucket"`
-	Endpoint        string `mapstructure:"endpoint"`
+	AccessKeyID     string        `mapstructure:"access_key_id"`
+	SecretAccessKey string        `mapstructure:"secret_access_key"`
+	Region          string        `mapstructure:"region"`
+	Bucket          string        `mapstructure:"bucket"`
+	Endpoint        string        `mapstructure:"endpoint"`
+	RetryAttempts   int           `mapstructure:"retry_attempts"`
+	RetryBackoff    time.Duration `mapstructure:"retry_backoff"`
+	PresignTTL      time.Duration `mapstructure:"presign_ttl"`
 }
 
 type AuthConfig struct {
+	Enabled  bool   `mapstructure:"enabled"`
+	APIKey   string `mapstructure:"api_key"`
+	KeysFile string `mapstructure:"keys_file"`
+}
+
+type LinksConfig struct {
+	Secret     string        `mapstructure:"secret"`
+	BaseURL    string        `mapstructure:"base_url"`
+	DefaultTTL time.Duration `mapstructure:"default_ttl"`
+	MaxTTL     time.Duration `mapstructure:"max_ttl"`
+}
+
+type MetricsConfig struct {
 	Enabled bool   `mapstructure:"enabled"`
-	APIKey  string `mapstructure:"api_key"`
+	Token   string `mapstructure:"token"`
+}
+
+type HealthConfig struct {
+	CacheTTL     time.Duration `mapstructure:"cache_ttl"`
+	CheckTimeout time.Duration `mapstructure:"check_timeout"`
+	MinFreeBytes uint64        `mapstructure:"min_free_bytes"`
+}
+
+type YtdlpConfig struct {
+	TempDir         string        `mapstructure:"temp_dir"`
+	JanitorInterval time.Duration `mapstructure:"janitor_interval"`
+	JanitorMaxAge   time.Duration `mapstructure:"janitor_max_age"`
+	JanitorMaxBytes int64         `mapstructure:"janitor_max_bytes"`
+	Concurrency     int           `mapstructure:"concurrency"`
+	MaxPerHost      int           `mapstructure:"max_per_host"`
+	RateLimit       string        `mapstructure:"rate_limit"`
+	RetryAttempts   int           `mapstructure:"retry_attempts"`
+	RetryBackoff    time.Duration `mapstructure:"retry_backoff"`
+}
+
+type TranscodeConfig struct {
+	ProfilesFile string `mapstructure:"profiles_file"`
+	Concurrency  int    `mapstructure:"concurrency"`
+	Threads      int    `mapstructure:"threads"`
+}
+
+type CredentialsConfig struct {
+	ProfilesFile string `mapstructure:"profiles_file"`
+}
+
+type ProxyConfig struct {
+	PoolsFile        string        `mapstructure:"pools_file"`
+	DefaultPool      string        `mapstructure:"default_pool"`
+	FailureThreshold int           `mapstructure:"failure_threshold"`
+	Cooldown         time.Duration `mapstructure:"cooldown"`
+}
+
+type TracingConfig struct {
+	Enabled     bool    `mapstructure:"enabled"`
+	Endpoint    string  `mapstructure:"endpoint"`
+	ServiceName string  `mapstructure:"service_name"`
+	SampleRatio float64 `mapstructure:"sample_ratio"`
+}
+
+type JobsConfig struct {
+	Path               string `mapstructure:"path"`
+	RequeueInterrupted bool   `mapstructure:"requeue_interrupted"`
+
+	BatchConcurrency    int `mapstructure:"batch_concurrency"`
+	BatchMaxConcurrency int `mapstructure:"batch_max_concurrency"`
+	BatchMaxItems       int `mapstructure:"batch_max_items"`
+
+	// Archive skips uploads of videos already uploaded to the same
+	// destination, unless a request sets archive itself.
+	Archive bool `mapstructure:"archive"`
+}
+
+type SubscriptionsConfig struct {
+	Enabled      bool          `mapstructure:"enabled"`
+	PollInterval time.Duration `mapstructure:"poll_interval"`
+	MinInterval  time.Duration `mapstructure:"min_interval"`
+	MaxEntries   int           `mapstructure:"max_entries"`
+	MaxAttempts  int           `mapstructure:"max_attempts"`
 }
 
 func NewConfig() (*Config, error) {
@@ -39,20 +133,106 @@ func NewConfig() (*Config, error) {
 	viper.BindEnv("s3.region", "S3_REGION")
 	viper.BindEnv("s3.bucket", "S3_BUCKET")
 	viper.BindEnv("s3.endpoint", "S3_ENDPOINT")
+	viper.BindEnv("s3.retry_attempts", "S3_RETRY_ATTEMPTS")
+	viper.BindEnv("s3.retry_backoff", "S3_RETRY_BACKOFF")
+	viper.BindEnv("s3.presign_ttl", "S3_PRESIGN_TTL")
 	viper.BindEnv("server.addr", "SERVER_ADDR")
+	viper.BindEnv("server.shutdown_delay", "SERVER_SHUTDOWN_DELAY")
+	viper.BindEnv("server.shutdown_timeout", "SERVER_SHUTDOWN_TIMEOUT")
+	viper.BindEnv("server.debug", "SERVER_DEBUG")
 	viper.BindEnv("auth.enabled", "AUTH_ENABLED")
 	viper.BindEnv("auth.api_key", "AUTH_API_KEY")
+	viper.BindEnv("auth.keys_file", "AUTH_KEYS_FILE")
+	viper.BindEnv("links.secret", "LINKS_SECRET")
+	viper.BindEnv("links.base_url", "LINKS_BASE_URL")
+	viper.BindEnv("links.default_ttl", "LINKS_DEFAULT_TTL")
+	viper.BindEnv("links.max_ttl", "LINKS_MAX_TTL")
+	viper.BindEnv("metrics.enabled", "METRICS_ENABLED")
+	viper.BindEnv("metrics.token", "METRICS_TOKEN")
+	viper.BindEnv("health.cache_ttl", "HEALTH_CACHE_TTL")
+	viper.BindEnv("health.check_timeout", "HEALTH_CHECK_TIMEOUT")
+	viper.BindEnv("health.min_free_bytes", "HEALTH_MIN_FREE_BYTES")
+	viper.BindEnv("ytdlp.temp_dir", "YTDLP_TEMP_DIR")
+	viper.BindEnv("ytdlp.janitor_interval", "YTDLP_JANITOR_INTERVAL")
+	viper.BindEnv("ytdlp.janitor_max_age", "YTDLP_JANITOR_MAX_AGE")
+	viper.BindEnv("ytdlp.janitor_max_bytes", "YTDLP_JANITOR_MAX_BYTES")
+	viper.BindEnv("ytdlp.concurrency", "YTDLP_CONCURRENCY")
+	viper.BindEnv("ytdlp.max_per_host", "YTDLP_MAX_PER_HOST")
+	viper.BindEnv("ytdlp.rate_limit", "YTDLP_RATE_LIMIT")
+	viper.BindEnv("ytdlp.retry_attempts", "YTDLP_RETRY_ATTEMPTS")
+	viper.BindEnv("ytdlp.retry_backoff", "YTDLP_RETRY_BACKOFF")
+	viper.BindEnv("transcode.profiles_file", "TRANSCODE_PROFILES_FILE")
+	viper.BindEnv("transcode.concurrency", "TRANSCODE_CONCURRENCY")
+	viper.BindEnv("transcode.threads", "TRANSCODE_THREADS")
+	viper.BindEnv("credentials.profiles_file", "CREDENTIALS_PROFILES_FILE")
+	viper.BindEnv("proxy.pools_file", "PROXY_POOLS_FILE")
+	viper.BindEnv("proxy.default_pool", "PROXY_DEFAULT_POOL")
+	viper.BindEnv("proxy.failure_threshold", "PROXY_FAILURE_THRESHOLD")
+	viper.BindEnv("proxy.cooldown", "PROXY_COOLDOWN")
+	viper.BindEnv("tracing.enabled", "TRACING_ENABLED")
+	viper.BindEnv("tracing.endpoint", "TRACING_ENDPOINT")
+	viper.BindEnv("tracing.service_name", "TRACING_SERVICE_NAME")
+	viper.BindEnv("tracing.sample_ratio", "TRACING_SAMPLE_RATIO")
+	viper.BindEnv("jobs.path", "JOBS_DB_PATH")
+	viper.BindEnv("jobs.requeue_interrupted", "JOBS_REQUEUE_INTERRUPTED")
+	viper.BindEnv("jobs.batch_concurrency", "JOBS_BATCH_CONCURRENCY")
+	viper.BindEnv("jobs.batch_max_concurrency", "JOBS_BATCH_MAX_CONCURRENCY")
+	viper.BindEnv("jobs.batch_max_items", "JOBS_BATCH_MAX_ITEMS")
+	viper.BindEnv("jobs.archive", "JOBS_ARCHIVE")
+	viper.BindEnv("subscriptions.enabled", "SUBSCRIPTIONS_ENABLED")
+	viper.BindEnv("subscriptions.poll_interval", "SUBSCRIPTIONS_POLL_INTERVAL")
+	viper.BindEnv("subscriptions.min_interval", "SUBSCRIPTIONS_MIN_INTERVAL")
+	viper.BindEnv("subscriptions.max_entries", "SUBSCRIPTIONS_MAX_ENTRIES")
+	viper.BindEnv("subscriptions.max_attempts", "SUBSCRIPTIONS_MAX_ATTEMPTS")
 
 	viper.SetDefault("server.addr", ":8080")
+	viper.SetDefault("server.shutdown_delay", "5s")
+	viper.SetDefault("server.shutdown_timeout", "10m")
+	viper.SetDefault("server.debug", false)
 	viper.SetDefault("auth.enabled", false)
+	viper.SetDefault("links.default_ttl", "1h")
+	viper.SetDefault("links.max_ttl", "168h")
+	viper.SetDefault("metrics.enabled", true)
+	viper.SetDefault("health.cache_ttl", "10s")
+	viper.SetDefault("health.check_timeout", "5s")
+	viper.SetDefault("health.min_free_bytes", 1<<30)
+	viper.SetDefault("ytdlp.janitor_interval", "10m")
+	viper.SetDefault("ytdlp.janitor_max_age", "6h")
+	viper.SetDefault("ytdlp.janitor_max_bytes", 0)
+	viper.SetDefault("ytdlp.concurrency", 1)
+	viper.SetDefault("ytdlp.max_per_host", 0)
+	viper.SetDefault("s3.retry_attempts", 3)
+	viper.SetDefault("s3.retry_backoff", "500ms")
+	viper.SetDefault("s3.presign_ttl", "1h")
+	viper.SetDefault("ytdlp.retry_attempts", 3)
+	viper.SetDefault("ytdlp.retry_backoff", "2s")
+	viper.SetDefault("transcode.concurrency", 1)
+	viper.SetDefault("transcode.threads", 0)
+	viper.SetDefault("proxy.failure_threshold", 3)
+	viper.SetDefault("proxy.cooldown", "10m")
+	viper.SetDefault("tracing.enabled", false)
+	viper.SetDefault("tracing.endpoint", "http://localhost:4318")
+	viper.SetDefault("tracing.service_name", "ytdlp-http")
+	viper.SetDefault("tracing.sample_ratio", 1.0)
+	viper.SetDefault("jobs.path", "data/jobs.db")
+	viper.SetDefault("jobs.requeue_interrupted", false)
+	viper.SetDefault("jobs.batch_concurrency", 2)
+	viper.SetDefault("jobs.batch_max_concurrency", 8)
+	viper.SetDefault("jobs.batch_max_items", 1000)
+	viper.SetDefault("jobs.archive", false)
+	viper.SetDefault("subscriptions.enabled", true)
+	viper.SetDefault("subscriptions.poll_interval", "30s")
+	viper.SetDefault("subscriptions.min_interval", "5m")
+	viper.SetDefault("subscriptions.max_entries", 500)
+	viper.SetDefault("subscriptions.max_attempts", 3)
 
 	var config Config
 	if err := viper.Unmarshal(&config); err != nil {
 		return nil, fmt.Errorf("unable to decode config: %w", err)
 	}
 
-	if config.Auth.Enabled && config.Auth.APIKey == "" {
-		log.Fatal("AUTH_API_KEY is required when auth is enabled")
+	if config.Auth.Enabled && config.Auth.APIKey == "" && config.Auth.KeysFile == "" {
+		log.Fatal("AUTH_API_KEY or AUTH_KEYS_FILE is required when auth is enabled")
 	}
 
 	if config.S3.AccessKeyID == "" || config.S3.SecretAccessKey == "" {
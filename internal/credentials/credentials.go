@@ -0,0 +1,144 @@
+package credentials
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrUnknownProfile = errors.New("unknown credential profile")
+	ErrSiteNotAllowed = errors.New("credential profile is not allowed for this site")
+	ErrScopeDenied    = errors.New("API key is not allowed to use this credential profile")
+)
+
+// Profile is a named set of credentials kept on the server. The file paths
+// are never sent to clients or written to logs.
+type Profile struct {
+	Name        string   `json:"name"`
+	CookiesFile string   `json:"cookies_file,omitempty"`
+	NetrcFile   string   `json:"netrc_file,omitempty"`
+	Sites       []string `json:"sites"`
+	Scopes      []string `json:"scopes,omitempty"`
+}
+
+type Store struct {
+	profiles map[string]*Profile
+	logger   *zap.Logger
+}
+
+func NewStore(cfg *configurations.CredentialsConfig, logger *zap.Logger) (*Store, error) {
+	store := &Store{
+		profiles: make(map[string]*Profile),
+		logger:   logger,
+	}
+	if cfg.ProfilesFile == "" {
+		return store, nil
+	}
+
+	data, err := os.ReadFile(cfg.ProfilesFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read credential profiles: %w", err)
+	}
+
+	var profiles []*Profile
+	if err := json.Unmarshal(data, &profiles); err != nil {
+		return nil, fmt.Errorf("failed to parse credential profiles: %w", err)
+	}
+
+	for _, profile := range profiles {
+		if err := profile.validate(); err != nil {
+			return nil, fmt.Errorf("invalid credential profile %q: %w", profile.Name, err)
+		}
+		store.profiles[profile.Name] = profile
+	}
+
+	logger.Info("Loaded credential profiles", zap.Strings("profiles", store.Names()))
+	return store, nil
+}
+
+// Names returns the configured profile names sorted alphabetically.
+func (s *Store) Names() []string {
+	names := make([]string, 0, len(s.profiles))
+	for name := range s.profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Resolve returns the named profile if it may be used to fetch rawURL by an
+// API key holding scopes.
+func (s *Store) Resolve(name, rawURL string, scopes []string) (*Profile, error) {
+	profile, ok := s.profiles[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+
+	parsed, err := url.Parse(rawURL)
+	if err != nil || !profile.allowsHost(parsed.Hostname()) {
+		return nil, fmt.Errorf("%w: %s", ErrSiteNotAllowed, name)
+	}
+
+	if !profile.allowsScopes(scopes) {
+		return nil, fmt.Errorf("%w: %s", ErrScopeDenied, name)
+	}
+
+	return profile, nil
+}
+
+func (p *Profile) validate() error {
+	if p.Name == "" {
+		return errors.New("name is required")
+	}
+	if (p.CookiesFile == "") == (p.NetrcFile == "") {
+		return errors.New("exactly one of cookies_file and netrc_file is required")
+	}
+	if len(p.Sites) == 0 {
+		return errors.New("at least one site is required")
+	}
+	for _, path := range []string{p.CookiesFile, p.NetrcFile} {
+		if path == "" {
+			continue
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("credential file is not readable: %w", err)
+		}
+	}
+	return nil
+}
+
+// allowsHost matches host against the profile's sites and their subdomains.
+func (p *Profile) allowsHost(host string) bool {
+	host = strings.ToLower(host)
+	for _, site := range p.Sites {
+		site = strings.ToLower(site)
+		if host == site || strings.HasSuffix(host, "."+site) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsScopes reports whether any of scopes grants access. Profiles without
+// scopes are available to every API key.
+func (p *Profile) allowsScopes(scopes []string) bool {
+	if len(p.Scopes) == 0 {
+		return true
+	}
+	for _, required := range p.Scopes {
+		for _, scope := range scopes {
+			if scope == required {
+				return true
+			}
+		}
+	}
+	return false
+}
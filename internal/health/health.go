@@ -0,0 +1,155 @@
+package health
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/s3"
+	"github.com/callmemars1/ytdlp-http/internal/utils"
+	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
+	"go.uber.org/zap"
+)
+
+const (
+	StatusOK   = "ok"
+	StatusFail = "fail"
+)
+
+type Checker struct {
+	config       *configurations.HealthConfig
+	ytdlpService *ytdlp.Service
+	s3Service    *s3.Service
+	logger       *zap.Logger
+
+	draining atomic.Bool
+
+	mu     sync.Mutex
+	cached *Report
+}
+
+type Report struct {
+	Ready     bool             `json:"ready"`
+	Draining  bool             `json:"draining,omitempty"`
+	Checks    map[string]Check `json:"checks"`
+	CheckedAt time.Time        `json:"checked_at"`
+}
+
+type Check struct {
+	Status    string `json:"status"`
+	Version   string `json:"version,omitempty"`
+	FreeBytes uint64 `json:"free_bytes,omitempty"`
+	Error     string `json:"error,omitempty"`
+}
+
+func NewChecker(cfg *configurations.HealthConfig, ytdlpService *ytdlp.Service, s3Service *s3.Service, logger *zap.Logger) *Checker {
+	return &Checker{
+		config:       cfg,
+		ytdlpService: ytdlpService,
+		s3Service:    s3Service,
+		logger:       logger,
+	}
+}
+
+// SetDraining marks the process as shutting down so readiness fails
+// and load balancers stop sending new traffic.
+func (c *Checker) SetDraining() {
+	c.draining.Store(true)
+}
+
+func (c *Checker) Draining() bool {
+	return c.draining.Load()
+}
+
+// Ready runs the dependency checks, reusing the previous report while it is
+// younger than the configured cache TTL.
+func (c *Checker) Ready(ctx context.Context) Report {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.cached == nil || time.Since(c.cached.CheckedAt) >= c.config.CacheTTL {
+		c.cached = c.runChecks(ctx)
+	}
+
+	report := *c.cached
+	if c.Draining() {
+		report.Ready = false
+		report.Draining = true
+	}
+	return report
+}
+
+func (c *Checker) runChecks(ctx context.Context) *Report {
+	ctx, cancel := context.WithTimeout(ctx, c.config.CheckTimeout)
+	defer cancel()
+
+	checks := map[string]Check{
+		"yt-dlp":   c.checkBinary(ctx, "yt-dlp", "--version"),
+		"ffmpeg":   c.checkBinary(ctx, "ffmpeg", "-version"),
+		"temp_dir": c.checkTempDir(),
+		"s3":       c.checkS3(ctx),
+	}
+
+	ready := true
+	for name, check := range checks {
+		if check.Status != StatusOK {
+			ready = false
+			c.logger.Warn("Readiness check failed", zap.String("check", name), zap.String("error", check.Error))
+		}
+	}
+
+	return &Report{
+		Ready:     ready,
+		Checks:    checks,
+		CheckedAt: time.Now(),
+	}
+}
+
+func (c *Checker) checkBinary(ctx context.Context, name string, versionArg string) Check {
+	output, err := exec.CommandContext(ctx, name, versionArg).Output()
+	if err != nil {
+		return Check{Status: StatusFail, Error: err.Error()}
+	}
+
+	version, _, _ := bufio.NewReader(bytes.NewReader(output)).ReadLine()
+	return Check{Status: StatusOK, Version: string(version)}
+}
+
+func (c *Checker) checkTempDir() Check {
+	dir := c.ytdlpService.TempDir()
+
+	probe, err := os.CreateTemp(dir, ".readyz-*")
+	if err != nil {
+		return Check{Status: StatusFail, Error: fmt.Sprintf("temp dir is not writable: %v", err)}
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+
+	free, err := utils.FreeSpace(dir)
+	if err != nil {
+		return Check{Status: StatusFail, Error: err.Error()}
+	}
+	if free < c.config.MinFreeBytes {
+		return Check{
+			Status:    StatusFail,
+			FreeBytes: free,
+			Error:     fmt.Sprintf("only %d bytes free, need at least %d", free, c.config.MinFreeBytes),
+		}
+	}
+
+	return Check{Status: StatusOK, FreeBytes: free}
+}
+
+func (c *Checker) checkS3(ctx context.Context) Check {
+	if err := c.s3Service.Ping(ctx); err != nil {
+		return Check{Status: StatusFail, Error: err.Error()}
+	}
+	return Check{Status: StatusOK}
+}
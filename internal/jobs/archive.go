@@ -0,0 +1,51 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// States of a download archive entry. A pending entry is reserved by a job
+// still uploading the video.
+const (
+	archivePending = "pending"
+	archiveDone    = "done"
+)
+
+// ReserveArchive adds entry to the download archive of destination as
+// pending for the given job. It reports false if the entry is already
+// archived or reserved by another job.
+func (s *Store) ReserveArchive(ctx context.Context, destination, entry, jobID string) (bool, error) {
+	result, err := s.db.ExecContext(ctx, `INSERT INTO archive (destination, entry, job_id, status, created_at)
+		VALUES (?, ?, ?, ?, ?) ON CONFLICT (destination, entry) DO NOTHING`,
+		destination, entry, jobID, archivePending, time.Now().UTC().UnixMilli())
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve download archive entry: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to reserve download archive entry: %w", err)
+	}
+	return affected == 1, nil
+}
+
+// CommitArchive marks an entry reserved by the job as archived.
+func (s *Store) CommitArchive(ctx context.Context, destination, entry, jobID string) error {
+	_, err := s.db.ExecContext(ctx, `UPDATE archive SET status = ? WHERE destination = ? AND entry = ? AND job_id = ?`,
+		archiveDone, destination, entry, jobID)
+	if err != nil {
+		return fmt.Errorf("failed to update download archive: %w", err)
+	}
+	return nil
+}
+
+// ReleaseArchive drops an entry the job reserved but did not upload.
+func (s *Store) ReleaseArchive(ctx context.Context, destination, entry, jobID string) error {
+	_, err := s.db.ExecContext(ctx, `DELETE FROM archive WHERE destination = ? AND entry = ? AND job_id = ? AND status = ?`,
+		destination, entry, jobID, archivePending)
+	if err != nil {
+		return fmt.Errorf("failed to release download archive entry: %w", err)
+	}
+	return nil
+}
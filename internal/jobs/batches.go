@@ -0,0 +1,97 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Batch groups upload jobs submitted together. Its progress is derived from
+// the jobs.
+type Batch struct {
+	ID          string    `json:"id"`
+	Requester   string    `json:"requester,omitempty"`
+	RequestID   string    `json:"request_id,omitempty"`
+	Concurrency int       `json:"concurrency"`
+	CreatedAt   time.Time `json:"created_at"`
+
+	// SubscriptionID is set for batches queued by a subscription run.
+	SubscriptionID string `json:"subscription_id,omitempty"`
+}
+
+// CreateBatch records batch and its items as queued jobs, filling in their
+// IDs and timestamps.
+func (s *Store) CreateBatch(ctx context.Context, batch *Batch, items []*Job) error {
+	now := time.Now().UTC()
+	batch.ID = newID()
+	batch.CreatedAt = now
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to create batch: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `INSERT INTO batches (id, requester, request_id, concurrency, subscription_id, created_at)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		batch.ID, batch.Requester, batch.RequestID, batch.Concurrency, batch.SubscriptionID, now.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to create batch: %w", err)
+	}
+
+	for i, job := range items {
+		job.ID = newID()
+		job.Status = StatusQueued
+		job.BatchID = batch.ID
+		job.BatchIndex = i
+		job.CreatedAt = now
+		job.StartedAt = nil
+		if err := insertJob(ctx, tx, job); err != nil {
+			return fmt.Errorf("failed to create batch item %d: %w", i, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to create batch: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) GetBatch(ctx context.Context, id string) (*Batch, error) {
+	var (
+		batch     Batch
+		createdAt int64
+	)
+	err := s.db.QueryRowContext(ctx, `SELECT id, requester, request_id, concurrency, subscription_id, created_at
+		FROM batches WHERE id = ?`, id).
+		Scan(&batch.ID, &batch.Requester, &batch.RequestID, &batch.Concurrency, &batch.SubscriptionID, &createdAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch: %w", err)
+	}
+	batch.CreatedAt = time.UnixMilli(createdAt).UTC()
+	return &batch, nil
+}
+
+// BatchJobs returns the jobs of a batch in submission order.
+func (s *Store) BatchJobs(ctx context.Context, id string) ([]*Job, error) {
+	rows, err := s.db.QueryContext(ctx, "SELECT "+columns+" FROM jobs WHERE batch_id = ? ORDER BY batch_index", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list batch jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var items []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, job)
+	}
+	return items, rows.Err()
+}
@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+var ErrInvalidFilter = errors.New("invalid job filter")
+
+const (
+	DefaultListLimit = 50
+	MaxListLimit     = 200
+)
+
+// Sort orders accepted by List. SortRelevance needs a Query.
+const (
+	SortCreatedAt  = "created_at"
+	SortFinishedAt = "finished_at"
+	SortSize       = "size"
+	SortTitle      = "title"
+	SortRelevance  = "relevance"
+)
+
+var sortColumns = map[string]string{
+	SortCreatedAt:  "jobs.created_at",
+	SortFinishedAt: "jobs.finished_at",
+	SortSize:       "jobs.size",
+	SortTitle:      "jobs.title COLLATE NOCASE",
+	SortRelevance:  "fts.rank",
+}
+
+// Filter selects jobs for List. Zero fields don't filter.
+type Filter struct {
+	Kind      Kind
+	Status    Status
+	Requester string
+	URL       string
+	VideoID   string
+	Uploader  string
+
+	// From and To bound created_at; From is inclusive and To exclusive.
+	From time.Time
+	To   time.Time
+
+	// Query is matched against title, description and tags.
+	Query string
+
+	Sort      string
+	Ascending bool
+	Limit     int
+	Offset    int
+}
+
+// List returns the jobs matching filter along with the total number of
+// matches ignoring Limit and Offset.
+func (s *Store) List(ctx context.Context, filter Filter) ([]*Job, int, error) {
+	from := "jobs"
+	var (
+		where []string
+		args  []any
+	)
+
+	if filter.Query != "" {
+		match := ftsQuery(filter.Query)
+		if match == "" {
+			return nil, 0, fmt.Errorf("%w: q has no searchable terms", ErrInvalidFilter)
+		}
+		from = `jobs JOIN (SELECT rowid, bm25(jobs_fts) AS rank FROM jobs_fts WHERE jobs_fts MATCH ?) AS fts
+			ON fts.rowid = jobs.rowid`
+		args = append(args, match)
+	}
+
+	add := func(clause string, value any) {
+		where = append(where, clause)
+		args = append(args, value)
+	}
+	if filter.Kind != "" {
+		add("jobs.kind = ?", filter.Kind)
+	}
+	if filter.Status != "" {
+		add("jobs.status = ?", filter.Status)
+	}
+	if filter.Requester != "" {
+		add("jobs.requester = ?", filter.Requester)
+	}
+	if filter.URL != "" {
+		add("jobs.url = ?", filter.URL)
+	}
+	if filter.VideoID != "" {
+		add("jobs.video_id = ?", filter.VideoID)
+	}
+	if filter.Uploader != "" {
+		add("jobs.uploader = ? COLLATE NOCASE", filter.Uploader)
+	}
+	if !filter.From.IsZero() {
+		add("jobs.created_at >= ?", filter.From.UnixMilli())
+	}
+	if !filter.To.IsZero() {
+		add("jobs.created_at < ?", filter.To.UnixMilli())
+	}
+
+	sort := filter.Sort
+	if sort == "" {
+		sort = SortCreatedAt
+		if filter.Query != "" {
+			sort = SortRelevance
+		}
+	}
+	column, ok := sortColumns[sort]
+	if !ok {
+		return nil, 0, fmt.Errorf("%w: unknown sort %q", ErrInvalidFilter, sort)
+	}
+	if sort == SortRelevance && filter.Query == "" {
+		return nil, 0, fmt.Errorf("%w: sort=relevance requires q", ErrInvalidFilter)
+	}
+	// bm25 scores better matches lower, so relevance reads the other way round.
+	ascending := filter.Ascending != (sort == SortRelevance)
+	direction := "DESC"
+	if ascending {
+		direction = "ASC"
+	}
+
+	limit := filter.Limit
+	if limit <= 0 {
+		limit = DefaultListLimit
+	}
+	if limit > MaxListLimit {
+		limit = MaxListLimit
+	}
+	offset := max(filter.Offset, 0)
+
+	query := " FROM " + from
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, "SELECT COUNT(*)"+query, args...).Scan(&total); err != nil {
+		return nil, 0, fmt.Errorf("failed to count jobs: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, "SELECT "+qualifiedColumns+query+
+		fmt.Sprintf(" ORDER BY %s %s, jobs.rowid %s LIMIT ? OFFSET ?", column, direction, direction),
+		append(args, limit, offset)...)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var list []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		list = append(list, job)
+	}
+	return list, total, rows.Err()
+}
+
+var qualifiedColumns = "jobs." + strings.Join(strings.Fields(strings.ReplaceAll(columns, ",", " ")), ", jobs.")
+
+// ftsQuery turns free text into an FTS5 query that matches documents
+// containing every word. Words are quoted so that FTS5 syntax in user input
+// is taken literally; a trailing * is kept as a prefix match.
+func ftsQuery(text string) string {
+	var terms []string
+	for _, word := range strings.Fields(text) {
+		prefix := strings.HasSuffix(word, "*")
+		word = strings.TrimRight(word, "*")
+		if word == "" {
+			continue
+		}
+		term := `"` + strings.ReplaceAll(word, `"`, `""`) + `"`
+		if prefix {
+			term += "*"
+		}
+		terms = append(terms, term)
+	}
+	return strings.Join(terms, " ")
+}
@@ -0,0 +1,129 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFTSQuery(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"", ""},
+		{"   ", ""},
+		{"cats", `"cats"`},
+		{"funny cats", `"funny" "cats"`},
+		{"cat*", `"cat"*`},
+		{"*", ""},
+		{`say "hi"`, `"say" """hi"""`},
+		{"title:cats OR dogs", `"title:cats" "OR" "dogs"`},
+		{"NEAR(a b)", `"NEAR(a" "b)"`},
+	}
+	for _, tt := range tests {
+		if got := ftsQuery(tt.text); got != tt.want {
+			t.Errorf("ftsQuery(%q) = %s, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestListSearch(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+
+	finish := func(requester, title, description string, tags ...string) *Job {
+		t.Helper()
+		job := &Job{Kind: KindUpload, Requester: requester, URL: "https://example.com/" + title}
+		if err := store.Create(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+		job.Status = StatusSucceeded
+		job.Title = title
+		job.Description = description
+		job.Tags = tags
+		if err := store.Finish(ctx, job); err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+	finish("alice", "Funny cats compilation", "Cats doing things", "cats", "funny")
+	finish("alice", "Dog training", "How to train a puppy", "dogs")
+	finish("bob", "Catalog of birds", "Birds of the world", "birds")
+
+	tests := []struct {
+		name   string
+		filter Filter
+		want   int
+	}{
+		{"all", Filter{}, 3},
+		{"requester", Filter{Requester: "alice"}, 2},
+		{"title word", Filter{Query: "funny"}, 1},
+		{"description word", Filter{Query: "puppy"}, 1},
+		{"tag", Filter{Query: "birds"}, 1},
+		{"every word", Filter{Query: "cats dog"}, 0},
+		{"prefix", Filter{Query: "cat*"}, 2},
+		{"prefix and requester", Filter{Query: "cat*", Requester: "bob"}, 1},
+		{"fts syntax is literal", Filter{Query: "cats OR dogs"}, 0},
+		{"status", Filter{Status: StatusFailed}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			list, total, err := store.List(ctx, tt.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != tt.want || len(list) != tt.want {
+				t.Errorf("List = %d jobs, total %d, want %d", len(list), total, tt.want)
+			}
+		})
+	}
+}
+
+func TestListSearchFollowsUpdates(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+
+	job := &Job{Kind: KindUpload, URL: "https://example.com/v"}
+	if err := store.Create(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	job.Status = StatusSucceeded
+	job.Title = "Original title"
+	if err := store.Finish(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	job.Title = "Renamed video"
+	if err := store.Finish(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	for query, want := range map[string]int{"original": 0, "renamed": 1} {
+		_, total, err := store.List(ctx, Filter{Query: query})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != want {
+			t.Errorf("List(q=%q) total = %d, want %d", query, total, want)
+		}
+	}
+}
+
+func TestListInvalidFilter(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		filter Filter
+	}{
+		{"no searchable terms", Filter{Query: "***"}},
+		{"unknown sort", Filter{Sort: "url"}},
+		{"relevance without query", Filter{Sort: SortRelevance}},
+	}
+	for _, tt := range tests {
+		if _, _, err := store.List(ctx, tt.filter); !errors.Is(err, ErrInvalidFilter) {
+			t.Errorf("%s: error = %v, want ErrInvalidFilter", tt.name, err)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+package jobs
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"go.uber.org/zap"
+	_ "modernc.org/sqlite"
+)
+
+var ErrNotFound = errors.New("job not found")
+
+type Kind string
+
+const (
+	KindDownload Kind = "download"
+	KindUpload   Kind = "upload"
+)
+
+type Status string
+
+const (
+	StatusQueued      Status = "queued"
+	StatusRunning     Status = "running"
+	StatusSucceeded   Status = "succeeded"
+	StatusFailed      Status = "failed"
+	StatusInterrupted Status = "interrupted"
+	StatusSkipped     Status = "skipped"
+)
+
+// Job is a single download or upload, as recorded for auditing.
+type Job struct {
+	ID        string `json:"id"`
+	Kind      Kind   `json:"kind"`
+	Status    Status `json:"status"`
+	Requester string `json:"requester,omitempty"`
+	RequestID string `json:"request_id,omitempty"`
+	URL       string `json:"url"`
+
+	// Request is the request body the job was started with, with secrets
+	// redacted.
+	Request json.RawMessage `json:"request,omitempty"`
+
+	// Scopes of the requester, kept so that a re-queued job is authorized
+	// the same way as the original request.
+	Scopes []string `json:"-"`
+
+	// BatchID is set for jobs submitted as part of a batch; BatchIndex is the
+	// job's position in it.
+	BatchID    string `json:"batch_id,omitempty"`
+	BatchIndex int    `json:"-"`
+
+	Title        string     `json:"title,omitempty"`
+	Extractor    string     `json:"extractor,omitempty"`
+	VideoID      string     `json:"video_id,omitempty"`
+	Uploader     string     `json:"uploader,omitempty"`
+	Description  string     `json:"description,omitempty"`
+	Tags         []string   `json:"tags,omitempty"`
+	Size         int64      `json:"size"`
+	S3Keys       []string   `json:"s3_keys,omitempty"`
+	Attempts     int        `json:"attempts"`
+	ErrorCode    string     `json:"error_code,omitempty"`
+	ErrorMessage string     `json:"error_message,omitempty"`
+	Skipped      string     `json:"skipped,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+	StartedAt    *time.Time `json:"started_at,omitempty"`
+	FinishedAt   *time.Time `json:"finished_at,omitempty"`
+}
+
+type Store struct {
+	db     *sql.DB
+	logger *zap.Logger
+}
+
+// migrations are applied in order; PRAGMA user_version holds how many ran.
+var migrations = []string{
+	`CREATE TABLE jobs (
+		id            TEXT PRIMARY KEY,
+		kind          TEXT NOT NULL,
+		status        TEXT NOT NULL,
+		requester     TEXT NOT NULL DEFAULT '',
+		request_id    TEXT NOT NULL DEFAULT '',
+		url           TEXT NOT NULL,
+		request       TEXT NOT NULL DEFAULT '{}',
+		scopes        TEXT NOT NULL DEFAULT '[]',
+		title         TEXT NOT NULL DEFAULT '',
+		extractor     TEXT NOT NULL DEFAULT '',
+		size          INTEGER NOT NULL DEFAULT 0,
+		s3_keys       TEXT NOT NULL DEFAULT '[]',
+		attempts      INTEGER NOT NULL DEFAULT 0,
+		error_code    TEXT NOT NULL DEFAULT '',
+		error_message TEXT NOT NULL DEFAULT '',
+		created_at    INTEGER NOT NULL,
+		started_at    INTEGER,
+		finished_at   INTEGER
+	);
+	CREATE INDEX jobs_status ON jobs (status);
+	CREATE INDEX jobs_created_at ON jobs (created_at);
+	CREATE INDEX jobs_requester ON jobs (requester, created_at);`,
+
+	`ALTER TABLE jobs ADD COLUMN video_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE jobs ADD COLUMN uploader TEXT NOT NULL DEFAULT '';
+	ALTER TABLE jobs ADD COLUMN description TEXT NOT NULL DEFAULT '';
+	ALTER TABLE jobs ADD COLUMN tags TEXT NOT NULL DEFAULT '[]';
+	CREATE INDEX jobs_video_id ON jobs (video_id);
+	CREATE INDEX jobs_uploader ON jobs (uploader COLLATE NOCASE);
+	CREATE VIRTUAL TABLE jobs_fts USING fts5(title, description, tags, content='jobs', content_rowid='rowid');
+	CREATE TRIGGER jobs_fts_insert AFTER INSERT ON jobs BEGIN
+		INSERT INTO jobs_fts (rowid, title, description, tags) VALUES (new.rowid, new.title, new.description, new.tags);
+	END;
+	CREATE TRIGGER jobs_fts_delete AFTER DELETE ON jobs BEGIN
+		INSERT INTO jobs_fts (jobs_fts, rowid, title, description, tags) VALUES ('delete', old.rowid, old.title, old.description, old.tags);
+	END;
+	CREATE TRIGGER jobs_fts_update AFTER UPDATE OF title, description, tags ON jobs BEGIN
+		INSERT INTO jobs_fts (jobs_fts, rowid, title, description, tags) VALUES ('delete', old.rowid, old.title, old.description, old.tags);
+		INSERT INTO jobs_fts (rowid, title, description, tags) VALUES (new.rowid, new.title, new.description, new.tags);
+	END;
+	INSERT INTO jobs_fts (jobs_fts) VALUES ('rebuild');`,
+
+	`CREATE TABLE batches (
+		id          TEXT PRIMARY KEY,
+		requester   TEXT NOT NULL DEFAULT '',
+		request_id  TEXT NOT NULL DEFAULT '',
+		concurrency INTEGER NOT NULL,
+		created_at  INTEGER NOT NULL
+	);
+	ALTER TABLE jobs ADD COLUMN batch_id TEXT NOT NULL DEFAULT '';
+	ALTER TABLE jobs ADD COLUMN batch_index INTEGER NOT NULL DEFAULT 0;
+	CREATE INDEX jobs_batch ON jobs (batch_id, batch_index);`,
+
+	`CREATE TABLE subscriptions (
+		id            TEXT PRIMARY KEY,
+		name          TEXT NOT NULL DEFAULT '',
+		url           TEXT NOT NULL,
+		s3_prefix     TEXT NOT NULL,
+		defaults      TEXT NOT NULL DEFAULT '{}',
+		interval_ms   INTEGER NOT NULL,
+		max_entries   INTEGER NOT NULL,
+		concurrency   INTEGER NOT NULL DEFAULT 0,
+		enabled       INTEGER NOT NULL DEFAULT 1,
+		requester     TEXT NOT NULL DEFAULT '',
+		scopes        TEXT NOT NULL DEFAULT '[]',
+		created_at    INTEGER NOT NULL,
+		updated_at    INTEGER NOT NULL,
+		next_run_at   INTEGER NOT NULL,
+		last_run_at   INTEGER,
+		last_status   TEXT NOT NULL DEFAULT '',
+		last_error    TEXT NOT NULL DEFAULT '',
+		last_batch_id TEXT NOT NULL DEFAULT '',
+		last_listed   INTEGER NOT NULL DEFAULT 0,
+		last_queued   INTEGER NOT NULL DEFAULT 0
+	);
+	CREATE INDEX subscriptions_next_run ON subscriptions (enabled, next_run_at);
+	CREATE TABLE subscription_entries (
+		subscription_id TEXT NOT NULL REFERENCES subscriptions (id) ON DELETE CASCADE,
+		video_id        TEXT NOT NULL,
+		url             TEXT NOT NULL,
+		job_id          TEXT NOT NULL,
+		attempts        INTEGER NOT NULL DEFAULT 1,
+		updated_at      INTEGER NOT NULL,
+		PRIMARY KEY (subscription_id, video_id)
+	);
+	ALTER TABLE batches ADD COLUMN subscription_id TEXT NOT NULL DEFAULT '';`,
+
+	`CREATE TABLE archive (
+		destination TEXT NOT NULL,
+		entry       TEXT NOT NULL,
+		job_id      TEXT NOT NULL,
+		created_at  INTEGER NOT NULL,
+		PRIMARY KEY (destination, entry)
+	);
+	ALTER TABLE jobs ADD COLUMN skipped TEXT NOT NULL DEFAULT '';`,
+
+	`ALTER TABLE archive ADD COLUMN status TEXT NOT NULL DEFAULT 'done';`,
+
+	`CREATE TABLE links (
+		id         TEXT PRIMARY KEY,
+		requester  TEXT NOT NULL DEFAULT '',
+		created_at INTEGER NOT NULL,
+		expires_at INTEGER NOT NULL,
+		revoked_at INTEGER
+	);
+	CREATE INDEX links_expires_at ON links (expires_at);`,
+
+	// Links minted before claims were stored carry them in the token; with
+	// no claims to serve they are dropped.
+	`DELETE FROM links;
+	ALTER TABLE links ADD COLUMN claims TEXT NOT NULL DEFAULT '{}';`,
+}
+
+const columns = `id, kind, status, requester, request_id, url, request, scopes, title, extractor,
+	video_id, uploader, description, tags, size, s3_keys, attempts, error_code, error_message,
+	created_at, started_at, finished_at, batch_id, batch_index, skipped`
+
+func NewStore(cfg *configurations.JobsConfig, logger *zap.Logger) (*Store, error) {
+	if err := os.MkdirAll(filepath.Dir(cfg.Path), 0755); err != nil {
+		return nil, fmt.Errorf("failed to create job store directory: %w", err)
+	}
+
+	dsn := "file:" + cfg.Path + "?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)&_pragma=foreign_keys(1)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open job store: %w", err)
+	}
+	// SQLite allows a single writer; serializing here avoids SQLITE_BUSY.
+	db.SetMaxOpenConns(1)
+
+	store := &Store{db: db, logger: logger}
+	if err := store.migrate(context.Background()); err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	logger.Info("Job store opened", zap.String("path", cfg.Path))
+	return store, nil
+}
+
+func (s *Store) migrate(ctx context.Context) error {
+	var version int
+	if err := s.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return fmt.Errorf("failed to read job store version: %w", err)
+	}
+
+	for i := version; i < len(migrations); i++ {
+		tx, err := s.db.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("failed to migrate job store: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, migrations[i]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply job store migration %d: %w", i+1, err)
+		}
+		if _, err := tx.ExecContext(ctx, fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("failed to apply job store migration %d: %w", i+1, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return fmt.Errorf("failed to apply job store migration %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (s *Store) Close() error {
+	return s.db.Close()
+}
+
+// Ping verifies that the database is usable.
+func (s *Store) Ping(ctx context.Context) error {
+	return s.db.PingContext(ctx)
+}
+
+// Create records a new job in the running state and fills in its ID and
+// timestamps.
+func (s *Store) Create(ctx context.Context, job *Job) error {
+	now := time.Now().UTC()
+	job.ID = newID()
+	job.Status = StatusRunning
+	job.CreatedAt = now
+	job.StartedAt = &now
+
+	if err := insertJob(ctx, s.db, job); err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+	return nil
+}
+
+type execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+func insertJob(ctx context.Context, db execer, job *Job) error {
+	if job.Request == nil {
+		job.Request = json.RawMessage("{}")
+	}
+	var startedAt sql.NullInt64
+	if job.StartedAt != nil {
+		startedAt = sql.NullInt64{Int64: job.StartedAt.UnixMilli(), Valid: true}
+	}
+
+	_, err := db.ExecContext(ctx, `INSERT INTO jobs (id, kind, status, requester, request_id, url, request, scopes,
+		batch_id, batch_index, created_at, started_at) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Kind, job.Status, job.Requester, job.RequestID, job.URL, string(job.Request),
+		encodeList(job.Scopes), job.BatchID, job.BatchIndex, job.CreatedAt.UnixMilli(), startedAt)
+	return err
+}
+
+// Start moves a queued job to running.
+func (s *Store) Start(ctx context.Context, job *Job) error {
+	now := time.Now().UTC()
+	job.Status = StatusRunning
+	job.StartedAt = &now
+	job.FinishedAt = nil
+	job.ErrorCode, job.ErrorMessage = "", ""
+
+	_, err := s.db.ExecContext(ctx, `UPDATE jobs SET status = ?, started_at = ?, finished_at = NULL,
+		error_code = '', error_message = '' WHERE id = ?`,
+		job.Status, now.UnixMilli(), job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to start job: %w", err)
+	}
+	return nil
+}
+
+// Finish records the outcome of job. Status must be succeeded, failed or
+// skipped.
+func (s *Store) Finish(ctx context.Context, job *Job) error {
+	now := time.Now().UTC()
+	job.FinishedAt = &now
+
+	_, err := s.db.ExecContext(ctx, `UPDATE jobs SET status = ?, title = ?, extractor = ?, video_id = ?,
+		uploader = ?, description = ?, tags = ?, size = ?, s3_keys = ?, attempts = ?, error_code = ?,
+		error_message = ?, skipped = ?, finished_at = ? WHERE id = ?`,
+		job.Status, job.Title, job.Extractor, job.VideoID, job.Uploader, job.Description,
+		encodeList(job.Tags), job.Size, encodeList(job.S3Keys), job.Attempts, job.ErrorCode,
+		job.ErrorMessage, job.Skipped, now.UnixMilli(), job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to finish job: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) Get(ctx context.Context, id string) (*Job, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+columns+" FROM jobs WHERE id = ?", id)
+	job, err := scanJob(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// Interrupt marks every queued or running job as interrupted and returns
+// them, releasing their download archive reservations. It is called on
+// startup, when no job can still be in progress.
+func (s *Store) Interrupt(ctx context.Context) ([]*Job, error) {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM archive WHERE status = ?", archivePending); err != nil {
+		return nil, fmt.Errorf("failed to release download archive reservations: %w", err)
+	}
+
+	now := time.Now().UTC().UnixMilli()
+	rows, err := s.db.QueryContext(ctx, `UPDATE jobs SET status = ?, finished_at = ?,
+		error_code = 'interrupted', error_message = 'Server restarted while the job was running'
+		WHERE status IN (?, ?) RETURNING `+columns,
+		StatusInterrupted, now, StatusQueued, StatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to mark interrupted jobs: %w", err)
+	}
+	defer rows.Close()
+
+	var interrupted []*Job
+	for rows.Next() {
+		job, err := scanJob(rows)
+		if err != nil {
+			return nil, err
+		}
+		interrupted = append(interrupted, job)
+	}
+	return interrupted, rows.Err()
+}
+
+// Requeue moves an interrupted job to the queued state.
+func (s *Store) Requeue(ctx context.Context, job *Job) error {
+	job.Status = StatusQueued
+	job.FinishedAt = nil
+	_, err := s.db.ExecContext(ctx, `UPDATE jobs SET status = ?, finished_at = NULL WHERE id = ?`,
+		job.Status, job.ID)
+	if err != nil {
+		return fmt.Errorf("failed to requeue job: %w", err)
+	}
+	return nil
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+func scanJob(row scanner) (*Job, error) {
+	var (
+		job                   Job
+		request, scopes, tags string
+		keys                  string
+		createdAt             int64
+		startedAt, finishedAt sql.NullInt64
+	)
+	err := row.Scan(&job.ID, &job.Kind, &job.Status, &job.Requester, &job.RequestID, &job.URL,
+		&request, &scopes, &job.Title, &job.Extractor, &job.VideoID, &job.Uploader, &job.Description,
+		&tags, &job.Size, &keys, &job.Attempts,
+		&job.ErrorCode, &job.ErrorMessage, &createdAt, &startedAt, &finishedAt, &job.BatchID, &job.BatchIndex, &job.Skipped)
+	if err != nil {
+		return nil, err
+	}
+
+	job.Request = json.RawMessage(request)
+	job.Scopes = decodeList(scopes)
+	job.Tags = decodeList(tags)
+	job.S3Keys = decodeList(keys)
+	job.CreatedAt = time.UnixMilli(createdAt).UTC()
+	job.StartedAt = fromMillis(startedAt)
+	job.FinishedAt = fromMillis(finishedAt)
+	return &job, nil
+}
+
+func fromMillis(value sql.NullInt64) *time.Time {
+	if !value.Valid {
+		return nil
+	}
+	t := time.UnixMilli(value.Int64).UTC()
+	return &t
+}
+
+func encodeList(values []string) string {
+	if len(values) == 0 {
+		return "[]"
+	}
+	data, _ := json.Marshal(values)
+	return string(data)
+}
+
+func decodeList(data string) []string {
+	var values []string
+	json.Unmarshal([]byte(strings.TrimSpace(data)), &values)
+	return values
+}
+
+func newID() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,273 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"go.uber.org/zap"
+)
+
+func newTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "jobs.db")
+	store, err := NewStore(&configurations.JobsConfig{Path: path}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("NewStore: %v", err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store, path
+}
+
+func TestMigrationsAreApplied(t *testing.T) {
+	store, path := newTestStore(t)
+	ctx := context.Background()
+
+	var version int
+	if err := store.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != len(migrations) {
+		t.Fatalf("user_version = %d, want %d", version, len(migrations))
+	}
+
+	job := &Job{Kind: KindUpload, URL: "https://example.com/v"}
+	if err := store.Create(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	// Reopening an up-to-date database applies nothing and keeps the data.
+	reopened, err := NewStore(&configurations.JobsConfig{Path: path}, zap.NewNop())
+	if err != nil {
+		t.Fatalf("reopen: %v", err)
+	}
+	defer reopened.Close()
+	if _, err := reopened.Get(ctx, job.ID); err != nil {
+		t.Fatalf("Get after reopen: %v", err)
+	}
+}
+
+func TestJobLifecycle(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+
+	job := &Job{
+		Kind:      KindUpload,
+		Requester: "alice",
+		URL:       "https://example.com/v",
+		Scopes:    []string{"upload"},
+	}
+	if err := store.Create(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+	if job.ID == "" || job.Status != StatusRunning || job.StartedAt == nil {
+		t.Fatalf("Create left job as %+v", job)
+	}
+
+	job.Status = StatusSucceeded
+	job.Title = "A title"
+	job.Tags = []string{"one", "two"}
+	job.S3Keys = []string{"a.mp4", "a.json"}
+	job.Size = 42
+	if err := store.Finish(ctx, job); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.Get(ctx, job.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusSucceeded || got.Title != "A title" || got.Size != 42 || got.FinishedAt == nil {
+		t.Errorf("Get = %+v", got)
+	}
+	if len(got.Tags) != 2 || len(got.S3Keys) != 2 || len(got.Scopes) != 1 {
+		t.Errorf("lists not round-tripped: tags %v, keys %v, scopes %v", got.Tags, got.S3Keys, got.Scopes)
+	}
+
+	if _, err := store.Get(ctx, "missing"); err != ErrNotFound {
+		t.Errorf("Get(missing) error = %v, want ErrNotFound", err)
+	}
+}
+
+func TestInterruptAndRequeue(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+
+	running := &Job{Kind: KindUpload, URL: "https://example.com/running"}
+	if err := store.Create(ctx, running); err != nil {
+		t.Fatal(err)
+	}
+	finished := &Job{Kind: KindUpload, URL: "https://example.com/finished"}
+	if err := store.Create(ctx, finished); err != nil {
+		t.Fatal(err)
+	}
+	finished.Status = StatusSucceeded
+	if err := store.Finish(ctx, finished); err != nil {
+		t.Fatal(err)
+	}
+	batch := &Batch{Concurrency: 1}
+	items := []*Job{
+		{Kind: KindUpload, URL: "https://example.com/1"},
+		{Kind: KindUpload, URL: "https://example.com/2"},
+	}
+	if err := store.CreateBatch(ctx, batch, items); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.ReserveArchive(ctx, "bucket/dir", "youtube pending", running.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.ReserveArchive(ctx, "bucket/dir", "youtube done", finished.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.CommitArchive(ctx, "bucket/dir", "youtube done", finished.ID); err != nil {
+		t.Fatal(err)
+	}
+
+	interrupted, err := store.Interrupt(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(interrupted) != 3 {
+		t.Fatalf("Interrupt returned %d jobs, want 3", len(interrupted))
+	}
+	for _, job := range interrupted {
+		if job.Status != StatusInterrupted || job.ErrorCode != "interrupted" || job.FinishedAt == nil {
+			t.Errorf("interrupted job = %+v", job)
+		}
+		if job.ID == finished.ID {
+			t.Errorf("finished job %s was interrupted", job.ID)
+		}
+	}
+
+	// Pending reservations are released, archived entries are kept.
+	tests := []struct {
+		entry    string
+		reserved bool
+	}{
+		{"youtube pending", true},
+		{"youtube done", false},
+	}
+	for _, tt := range tests {
+		reserved, err := store.ReserveArchive(ctx, "bucket/dir", tt.entry, "other")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if reserved != tt.reserved {
+			t.Errorf("ReserveArchive(%q) after Interrupt = %v, want %v", tt.entry, reserved, tt.reserved)
+		}
+	}
+
+	if err := store.Requeue(ctx, interrupted[0]); err != nil {
+		t.Fatal(err)
+	}
+	got, err := store.Get(ctx, interrupted[0].ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != StatusQueued || got.FinishedAt != nil {
+		t.Errorf("requeued job = %+v", got)
+	}
+
+	// Nothing is left to interrupt on the next start except the requeued job.
+	again, err := store.Interrupt(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again) != 1 || again[0].ID != got.ID {
+		t.Errorf("second Interrupt returned %d jobs", len(again))
+	}
+}
+
+func TestArchiveReservation(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	const destination, entry = "bucket/channel", "youtube abc"
+
+	steps := []struct {
+		name string
+		run  func() (bool, error)
+		want bool
+	}{
+		{"first reservation", func() (bool, error) { return store.ReserveArchive(ctx, destination, entry, "job1") }, true},
+		{"concurrent reservation", func() (bool, error) { return store.ReserveArchive(ctx, destination, entry, "job2") }, false},
+		{"other destination", func() (bool, error) { return store.ReserveArchive(ctx, "bucket/other", entry, "job2") }, true},
+		{"after release", func() (bool, error) {
+			if err := store.ReleaseArchive(ctx, destination, entry, "job1"); err != nil {
+				return false, err
+			}
+			return store.ReserveArchive(ctx, destination, entry, "job3")
+		}, true},
+		{"after commit", func() (bool, error) {
+			if err := store.CommitArchive(ctx, destination, entry, "job3"); err != nil {
+				return false, err
+			}
+			// Releasing a committed entry does nothing.
+			if err := store.ReleaseArchive(ctx, destination, entry, "job3"); err != nil {
+				return false, err
+			}
+			return store.ReserveArchive(ctx, destination, entry, "job4")
+		}, false},
+	}
+	for _, step := range steps {
+		got, err := step.run()
+		if err != nil {
+			t.Fatalf("%s: %v", step.name, err)
+		}
+		if got != step.want {
+			t.Errorf("%s: reserved = %v, want %v", step.name, got, step.want)
+		}
+	}
+}
+
+func TestLinks(t *testing.T) {
+	store, _ := newTestStore(t)
+	ctx := context.Background()
+	now := time.Now()
+
+	live := &Link{ID: "live", Requester: "alice", Claims: json.RawMessage(`{"url":"https://example.com/v"}`), ExpiresAt: now.Add(time.Hour)}
+	if err := store.SaveLink(ctx, live); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SaveLink(ctx, &Link{ID: "expired", Claims: json.RawMessage(`{}`), ExpiresAt: now.Add(-time.Second)}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := store.GetLink(ctx, "live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Requester != "alice" || string(got.Claims) != string(live.Claims) || got.RevokedAt != nil {
+		t.Errorf("GetLink = %+v", got)
+	}
+	if _, err := store.GetLink(ctx, "expired"); err != ErrNotFound {
+		t.Errorf("GetLink(expired) error = %v, want ErrNotFound", err)
+	}
+
+	tests := []struct {
+		id      string
+		wantErr error
+	}{
+		{"live", nil},
+		{"live", nil},
+		{"expired", ErrNotFound},
+		{"unknown", ErrNotFound},
+	}
+	for _, tt := range tests {
+		if err := store.RevokeLink(ctx, tt.id); err != tt.wantErr {
+			t.Errorf("RevokeLink(%q) error = %v, want %v", tt.id, err, tt.wantErr)
+		}
+	}
+
+	got, err = store.GetLink(ctx, "live")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.RevokedAt == nil {
+		t.Error("revoked link has no RevokedAt")
+	}
+}
@@ -0,0 +1,85 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Link is a minted download link. Claims holds what the link downloads; it
+// is kept server-side so that tokens carry nothing but the link ID.
+type Link struct {
+	ID        string
+	Requester string
+	Claims    json.RawMessage
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	RevokedAt *time.Time
+}
+
+// SaveLink records a minted download link until it expires.
+func (s *Store) SaveLink(ctx context.Context, link *Link) error {
+	now := time.Now().UTC()
+	// Expired links are rejected before they are looked up, so their rows
+	// are no longer needed.
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM links WHERE expires_at <= ?`, now.UnixMilli()); err != nil {
+		return fmt.Errorf("failed to prune expired links: %w", err)
+	}
+	link.CreatedAt = now
+	_, err := s.db.ExecContext(ctx, `INSERT INTO links (id, requester, claims, created_at, expires_at) VALUES (?, ?, ?, ?, ?)`,
+		link.ID, link.Requester, string(link.Claims), now.UnixMilli(), link.ExpiresAt.UTC().UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to save link: %w", err)
+	}
+	return nil
+}
+
+// GetLink returns the link with the given ID, or ErrNotFound if there is no
+// unexpired link with that ID.
+func (s *Store) GetLink(ctx context.Context, id string) (*Link, error) {
+	var (
+		link                 Link
+		claims               string
+		createdAt, expiresAt int64
+		revokedAt            sql.NullInt64
+	)
+	err := s.db.QueryRowContext(ctx, `SELECT id, requester, claims, created_at, expires_at, revoked_at
+		FROM links WHERE id = ? AND expires_at > ?`, id, time.Now().UTC().UnixMilli()).
+		Scan(&link.ID, &link.Requester, &claims, &createdAt, &expiresAt, &revokedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get link: %w", err)
+	}
+	link.Claims = json.RawMessage(claims)
+	link.CreatedAt = time.UnixMilli(createdAt).UTC()
+	link.ExpiresAt = time.UnixMilli(expiresAt).UTC()
+	if revokedAt.Valid {
+		t := time.UnixMilli(revokedAt.Int64).UTC()
+		link.RevokedAt = &t
+	}
+	return &link, nil
+}
+
+// RevokeLink marks a link as revoked. It returns ErrNotFound if no unexpired
+// link has that ID.
+func (s *Store) RevokeLink(ctx context.Context, id string) error {
+	now := time.Now().UTC().UnixMilli()
+	result, err := s.db.ExecContext(ctx, `UPDATE links SET revoked_at = COALESCE(revoked_at, ?) WHERE id = ? AND expires_at > ?`,
+		now, id, now)
+	if err != nil {
+		return fmt.Errorf("failed to revoke link: %w", err)
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to revoke link: %w", err)
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
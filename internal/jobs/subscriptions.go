@@ -0,0 +1,260 @@
+package jobs
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Outcomes of a subscription run.
+const (
+	RunSucceeded = "succeeded"
+	RunFailed    = "failed"
+)
+
+// Subscription is a channel or playlist that is synced on a schedule. New
+// entries are uploaded under S3Prefix, with Defaults applied as in a batch.
+type Subscription struct {
+	ID          string          `json:"id"`
+	Name        string          `json:"name,omitempty"`
+	URL         string          `json:"url"`
+	S3Prefix    string          `json:"s3_prefix"`
+	Defaults    json.RawMessage `json:"defaults,omitempty"`
+	Interval    time.Duration   `json:"-"`
+	MaxEntries  int             `json:"max_entries"`
+	Concurrency int             `json:"concurrency,omitempty"`
+	Enabled     bool            `json:"enabled"`
+	Requester   string          `json:"requester,omitempty"`
+
+	// Scopes of the requester, so that scheduled runs are authorized the same
+	// way as the request that created the subscription.
+	Scopes []string `json:"-"`
+
+	CreatedAt time.Time        `json:"created_at"`
+	UpdatedAt time.Time        `json:"updated_at"`
+	NextRunAt time.Time        `json:"next_run_at"`
+	LastRun   *SubscriptionRun `json:"last_run,omitempty"`
+}
+
+// SubscriptionRun is the outcome of the last sync of a subscription.
+type SubscriptionRun struct {
+	At      time.Time `json:"at"`
+	Status  string    `json:"status"`
+	Error   string    `json:"error,omitempty"`
+	BatchID string    `json:"batch_id,omitempty"`
+	Listed  int       `json:"listed"`
+	Queued  int       `json:"queued"`
+}
+
+// SubscriptionEntry is a video a subscription has queued, with the status of
+// its latest job.
+type SubscriptionEntry struct {
+	VideoID  string
+	URL      string
+	JobID    string
+	Attempts int
+	Status   Status
+}
+
+const subscriptionColumns = `id, name, url, s3_prefix, defaults, interval_ms, max_entries, concurrency,
+	enabled, requester, scopes, created_at, updated_at, next_run_at, last_run_at, last_status,
+	last_error, last_batch_id, last_listed, last_queued`
+
+// CreateSubscription records sub and schedules its first run right away.
+func (s *Store) CreateSubscription(ctx context.Context, sub *Subscription) error {
+	now := time.Now().UTC()
+	sub.ID = newID()
+	sub.CreatedAt = now
+	sub.UpdatedAt = now
+	sub.NextRunAt = now
+	if sub.Defaults == nil {
+		sub.Defaults = json.RawMessage("{}")
+	}
+
+	_, err := s.db.ExecContext(ctx, `INSERT INTO subscriptions (id, name, url, s3_prefix, defaults, interval_ms,
+		max_entries, concurrency, enabled, requester, scopes, created_at, updated_at, next_run_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		sub.ID, sub.Name, sub.URL, sub.S3Prefix, string(sub.Defaults), sub.Interval.Milliseconds(),
+		sub.MaxEntries, sub.Concurrency, sub.Enabled, sub.Requester, encodeList(sub.Scopes),
+		now.UnixMilli(), now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return fmt.Errorf("failed to create subscription: %w", err)
+	}
+	return nil
+}
+
+// UpdateSubscription saves the settings of sub. The next run is moved to
+// one interval after the last run, or to now if it never ran.
+func (s *Store) UpdateSubscription(ctx context.Context, sub *Subscription) error {
+	now := time.Now().UTC()
+	sub.UpdatedAt = now
+	sub.NextRunAt = now
+	if sub.LastRun != nil {
+		sub.NextRunAt = sub.LastRun.At.Add(sub.Interval)
+	}
+
+	result, err := s.db.ExecContext(ctx, `UPDATE subscriptions SET name = ?, url = ?, s3_prefix = ?, defaults = ?,
+		interval_ms = ?, max_entries = ?, concurrency = ?, enabled = ?, updated_at = ?, next_run_at = ?
+		WHERE id = ?`,
+		sub.Name, sub.URL, sub.S3Prefix, string(sub.Defaults), sub.Interval.Milliseconds(), sub.MaxEntries,
+		sub.Concurrency, sub.Enabled, now.UnixMilli(), sub.NextRunAt.UnixMilli(), sub.ID)
+	if err != nil {
+		return fmt.Errorf("failed to update subscription: %w", err)
+	}
+	return checkAffected(result)
+}
+
+func (s *Store) GetSubscription(ctx context.Context, id string) (*Subscription, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+subscriptionColumns+" FROM subscriptions WHERE id = ?", id)
+	sub, err := scanSubscription(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrNotFound
+	}
+	return sub, err
+}
+
+func (s *Store) ListSubscriptions(ctx context.Context) ([]*Subscription, error) {
+	return s.querySubscriptions(ctx, "SELECT "+subscriptionColumns+" FROM subscriptions ORDER BY created_at")
+}
+
+// DueSubscriptions returns the enabled subscriptions whose next run is not
+// after now.
+func (s *Store) DueSubscriptions(ctx context.Context, now time.Time) ([]*Subscription, error) {
+	return s.querySubscriptions(ctx, "SELECT "+subscriptionColumns+` FROM subscriptions
+		WHERE enabled = 1 AND next_run_at <= ? ORDER BY next_run_at`, now.UnixMilli())
+}
+
+// DeleteSubscription removes a subscription and the record of its entries.
+// Jobs it queued are kept.
+func (s *Store) DeleteSubscription(ctx context.Context, id string) error {
+	result, err := s.db.ExecContext(ctx, "DELETE FROM subscriptions WHERE id = ?", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete subscription: %w", err)
+	}
+	return checkAffected(result)
+}
+
+// RecordSubscriptionRun stores run as the last run of sub and schedules the
+// next one an interval later.
+func (s *Store) RecordSubscriptionRun(ctx context.Context, sub *Subscription, run *SubscriptionRun) error {
+	sub.LastRun = run
+	sub.NextRunAt = run.At.Add(sub.Interval)
+
+	_, err := s.db.ExecContext(ctx, `UPDATE subscriptions SET last_run_at = ?, last_status = ?, last_error = ?,
+		last_batch_id = ?, last_listed = ?, last_queued = ?, next_run_at = ? WHERE id = ?`,
+		run.At.UnixMilli(), run.Status, run.Error, run.BatchID, run.Listed, run.Queued,
+		sub.NextRunAt.UnixMilli(), sub.ID)
+	if err != nil {
+		return fmt.Errorf("failed to record subscription run: %w", err)
+	}
+	return nil
+}
+
+// SubscriptionEntries returns the entries sub has queued, by video ID.
+func (s *Store) SubscriptionEntries(ctx context.Context, id string) (map[string]*SubscriptionEntry, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT e.video_id, e.url, e.job_id, e.attempts, COALESCE(j.status, '')
+		FROM subscription_entries e LEFT JOIN jobs j ON j.id = e.job_id
+		WHERE e.subscription_id = ?`, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscription entries: %w", err)
+	}
+	defer rows.Close()
+
+	entries := make(map[string]*SubscriptionEntry)
+	for rows.Next() {
+		var entry SubscriptionEntry
+		if err := rows.Scan(&entry.VideoID, &entry.URL, &entry.JobID, &entry.Attempts, &entry.Status); err != nil {
+			return nil, err
+		}
+		entries[entry.VideoID] = &entry
+	}
+	return entries, rows.Err()
+}
+
+// SaveSubscriptionEntries records that entries were queued as the given
+// jobs, counting an attempt for entries queued before.
+func (s *Store) SaveSubscriptionEntries(ctx context.Context, id string, entries []*SubscriptionEntry) error {
+	now := time.Now().UTC().UnixMilli()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to save subscription entries: %w", err)
+	}
+	defer tx.Rollback()
+
+	for _, entry := range entries {
+		_, err := tx.ExecContext(ctx, `INSERT INTO subscription_entries (subscription_id, video_id, url, job_id, updated_at)
+			VALUES (?, ?, ?, ?, ?)
+			ON CONFLICT (subscription_id, video_id) DO UPDATE SET
+				url = excluded.url, job_id = excluded.job_id, attempts = attempts + 1, updated_at = excluded.updated_at`,
+			id, entry.VideoID, entry.URL, entry.JobID, now)
+		if err != nil {
+			return fmt.Errorf("failed to save subscription entry %s: %w", entry.VideoID, err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to save subscription entries: %w", err)
+	}
+	return nil
+}
+
+func (s *Store) querySubscriptions(ctx context.Context, query string, args ...any) ([]*Subscription, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list subscriptions: %w", err)
+	}
+	defer rows.Close()
+
+	var subs []*Subscription
+	for rows.Next() {
+		sub, err := scanSubscription(rows)
+		if err != nil {
+			return nil, err
+		}
+		subs = append(subs, sub)
+	}
+	return subs, rows.Err()
+}
+
+func scanSubscription(row scanner) (*Subscription, error) {
+	var (
+		sub                             Subscription
+		defaults, scopes                string
+		intervalMs                      int64
+		createdAt, updatedAt, nextRunAt int64
+		lastRunAt                       sql.NullInt64
+		run                             SubscriptionRun
+	)
+	err := row.Scan(&sub.ID, &sub.Name, &sub.URL, &sub.S3Prefix, &defaults, &intervalMs, &sub.MaxEntries,
+		&sub.Concurrency, &sub.Enabled, &sub.Requester, &scopes, &createdAt, &updatedAt, &nextRunAt,
+		&lastRunAt, &run.Status, &run.Error, &run.BatchID, &run.Listed, &run.Queued)
+	if err != nil {
+		return nil, err
+	}
+
+	sub.Defaults = json.RawMessage(defaults)
+	sub.Interval = time.Duration(intervalMs) * time.Millisecond
+	sub.Scopes = decodeList(scopes)
+	sub.CreatedAt = time.UnixMilli(createdAt).UTC()
+	sub.UpdatedAt = time.UnixMilli(updatedAt).UTC()
+	sub.NextRunAt = time.UnixMilli(nextRunAt).UTC()
+	if lastRunAt.Valid {
+		run.At = time.UnixMilli(lastRunAt.Int64).UTC()
+		sub.LastRun = &run
+	}
+	return &sub, nil
+}
+
+func checkAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,203 @@
+package links
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/jobs"
+	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
+	"go.uber.org/zap"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid link token")
+	ErrIPMismatch   = errors.New("link is bound to another IP address")
+	ErrExpired      = errors.New("link has expired")
+	ErrRevoked      = errors.New("link has been revoked")
+	ErrNotFound     = errors.New("link not found")
+)
+
+type Service struct {
+	config   *configurations.LinksConfig
+	secret   []byte
+	jobStore *jobs.Store
+	logger   *zap.Logger
+}
+
+// Claims describes what a download link downloads. They are stored in the
+// job store under the link ID and never leave the server, since options may
+// hold proxy credentials.
+type Claims struct {
+	ID               string         `json:"-"`
+	URL              string         `json:"url"`
+	Options          *ytdlp.Options `json:"options,omitempty"`
+	Profile          string         `json:"profile,omitempty"`
+	Timeout          int            `json:"timeout,omitempty"`
+	IncludeSubtitles bool           `json:"subs,omitempty"`
+	IP               string         `json:"ip,omitempty"`
+	ExpiresAt        int64          `json:"-"`
+
+	// Name and scopes of the API key that minted the link. Scopes authorize
+	// its credential profile when the link is redeemed.
+	Requester string   `json:"-"`
+	Scopes    []string `json:"scopes,omitempty"`
+}
+
+// token is the signed payload of a download link.
+type token struct {
+	ID        string `json:"id"`
+	IP        string `json:"ip,omitempty"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+func NewService(cfg *configurations.LinksConfig, jobStore *jobs.Store, logger *zap.Logger) (*Service, error) {
+	secret := []byte(cfg.Secret)
+	if len(secret) == 0 {
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, fmt.Errorf("failed to generate link secret: %w", err)
+		}
+		logger.Warn("LINKS_SECRET is not set, generated an ephemeral secret; links will not survive a restart")
+	}
+
+	return &Service{
+		config:   cfg,
+		secret:   secret,
+		jobStore: jobStore,
+		logger:   logger,
+	}, nil
+}
+
+// Sign fills in the link ID and expiry, stores the claims and returns the
+// signed token.
+func (s *Service) Sign(ctx context.Context, claims *Claims, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = s.config.DefaultTTL
+	}
+	if s.config.MaxTTL > 0 && ttl > s.config.MaxTTL {
+		ttl = s.config.MaxTTL
+	}
+
+	idBytes := make([]byte, 12)
+	if _, err := rand.Read(idBytes); err != nil {
+		return "", fmt.Errorf("failed to generate link id: %w", err)
+	}
+	claims.ID = hex.EncodeToString(idBytes)
+	expiresAt := time.Now().Add(ttl)
+	claims.ExpiresAt = expiresAt.Unix()
+
+	stored, err := json.Marshal(claims)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal link claims: %w", err)
+	}
+	if err := s.jobStore.SaveLink(ctx, &jobs.Link{
+		ID:        claims.ID,
+		Requester: claims.Requester,
+		Claims:    stored,
+		ExpiresAt: expiresAt,
+	}); err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(token{ID: claims.ID, IP: claims.IP, ExpiresAt: claims.ExpiresAt})
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal link token: %w", err)
+	}
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.sign(encoded)), nil
+}
+
+// Verify checks the token signature, expiry, revocation and IP binding, and
+// returns the stored claims of the link.
+func (s *Service) Verify(ctx context.Context, signed, clientIP string) (*Claims, error) {
+	encoded, signature, ok := strings.Cut(signed, ".")
+	if !ok {
+		return nil, ErrInvalidToken
+	}
+
+	providedSig, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(providedSig, s.sign(encoded)) {
+		return nil, ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	var tok token
+	if err := json.Unmarshal(payload, &tok); err != nil {
+		return nil, ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= tok.ExpiresAt {
+		return nil, ErrExpired
+	}
+	link, err := s.jobStore.GetLink(ctx, tok.ID)
+	if errors.Is(err, jobs.ErrNotFound) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	if link.RevokedAt != nil {
+		return nil, ErrRevoked
+	}
+	if tok.IP != "" && tok.IP != clientIP {
+		return nil, ErrIPMismatch
+	}
+
+	return linkClaims(link)
+}
+
+// Get returns the claims of an unexpired link, or ErrNotFound.
+func (s *Service) Get(ctx context.Context, id string) (*Claims, error) {
+	link, err := s.jobStore.GetLink(ctx, id)
+	if errors.Is(err, jobs.ErrNotFound) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return linkClaims(link)
+}
+
+// Revoke invalidates a link by ID. Revocations are stored in the job store
+// until the link expires, so they survive restarts.
+func (s *Service) Revoke(ctx context.Context, id string) error {
+	if err := s.jobStore.RevokeLink(ctx, id); err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			return ErrNotFound
+		}
+		return err
+	}
+	s.logger.Info("Download link revoked", zap.String("link_id", id))
+	return nil
+}
+
+func linkClaims(link *jobs.Link) (*Claims, error) {
+	var claims Claims
+	if err := json.Unmarshal(link.Claims, &claims); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal link claims: %w", err)
+	}
+	claims.ID = link.ID
+	claims.Requester = link.Requester
+	claims.ExpiresAt = link.ExpiresAt.Unix()
+	return &claims, nil
+}
+
+func (s *Service) sign(encoded string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(encoded))
+	return mac.Sum(nil)
+}
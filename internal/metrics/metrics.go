@@ -0,0 +1,144 @@
+package metrics
+
+import (
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ytdlp_http"
+
+type Metrics struct {
+	registry *prometheus.Registry
+
+	HTTPRequests        *prometheus.CounterVec
+	HTTPRequestDuration *prometheus.HistogramVec
+
+	YtdlpInvocations *prometheus.CounterVec
+	DownloadDuration prometheus.Histogram
+	DownloadBytes    prometheus.Counter
+	QueueDepth       prometheus.Gauge
+	ActiveWorkers    prometheus.Gauge
+
+	S3UploadDuration prometheus.Histogram
+	S3UploadBytes    prometheus.Counter
+	S3UploadErrors   prometheus.Counter
+}
+
+func New() *Metrics {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	factory := newFactory(registry)
+
+	return &Metrics{
+		registry: registry,
+
+		HTTPRequests: factory.counterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests by route, method and status.",
+		}, []string{"route", "method", "status"}),
+		HTTPRequestDuration: factory.histogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency by route, method and status.",
+			Buckets: []float64{0.01, 0.05, 0.1, 0.5, 1, 5, 15, 30, 60, 120, 300, 600},
+		}, []string{"route", "method", "status"}),
+
+		YtdlpInvocations: factory.counterVec(prometheus.CounterOpts{
+			Name: "ytdlp_invocations_total",
+			Help: "yt-dlp invocations by operation, outcome and extractor.",
+		}, []string{"operation", "outcome", "extractor"}),
+		DownloadDuration: factory.histogram(prometheus.HistogramOpts{
+			Name:    "download_duration_seconds",
+			Help:    "Time spent running yt-dlp downloads.",
+			Buckets: []float64{1, 5, 15, 30, 60, 120, 300, 600, 1200},
+		}),
+		DownloadBytes: factory.counter(prometheus.CounterOpts{
+			Name: "download_bytes_total",
+			Help: "Bytes of media downloaded by yt-dlp.",
+		}),
+		QueueDepth: factory.gauge(prometheus.GaugeOpts{
+			Name: "queue_depth",
+			Help: "yt-dlp jobs waiting for a free worker.",
+		}),
+		ActiveWorkers: factory.gauge(prometheus.GaugeOpts{
+			Name: "active_workers",
+			Help: "yt-dlp jobs currently running.",
+		}),
+
+		S3UploadDuration: factory.histogram(prometheus.HistogramOpts{
+			Name:    "s3_upload_duration_seconds",
+			Help:    "Time spent uploading objects to S3-compatible storage.",
+			Buckets: []float64{0.1, 0.5, 1, 5, 15, 30, 60, 120, 300},
+		}),
+		S3UploadBytes: factory.counter(prometheus.CounterOpts{
+			Name: "s3_upload_bytes_total",
+			Help: "Bytes uploaded to S3-compatible storage.",
+		}),
+		S3UploadErrors: factory.counter(prometheus.CounterOpts{
+			Name: "s3_upload_errors_total",
+			Help: "Failed uploads to S3-compatible storage.",
+		}),
+	}
+}
+
+// RegisterGaugeFunc exposes a gauge whose value is computed on every scrape.
+func (m *Metrics) RegisterGaugeFunc(name, help string, fn func() float64) {
+	m.registry.MustRegister(prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      name,
+		Help:      help,
+	}, fn))
+}
+
+func (m *Metrics) Handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+type factory struct {
+	registry *prometheus.Registry
+}
+
+func newFactory(registry *prometheus.Registry) factory {
+	return factory{registry: registry}
+}
+
+func (f factory) counter(opts prometheus.CounterOpts) prometheus.Counter {
+	opts.Namespace = namespace
+	c := prometheus.NewCounter(opts)
+	f.registry.MustRegister(c)
+	return c
+}
+
+func (f factory) counterVec(opts prometheus.CounterOpts, labels []string) *prometheus.CounterVec {
+	opts.Namespace = namespace
+	c := prometheus.NewCounterVec(opts, labels)
+	f.registry.MustRegister(c)
+	return c
+}
+
+func (f factory) gauge(opts prometheus.GaugeOpts) prometheus.Gauge {
+	opts.Namespace = namespace
+	g := prometheus.NewGauge(opts)
+	f.registry.MustRegister(g)
+	return g
+}
+
+func (f factory) histogram(opts prometheus.HistogramOpts) prometheus.Histogram {
+	opts.Namespace = namespace
+	h := prometheus.NewHistogram(opts)
+	f.registry.MustRegister(h)
+	return h
+}
+
+func (f factory) histogramVec(opts prometheus.HistogramOpts, labels []string) *prometheus.HistogramVec {
+	opts.Namespace = namespace
+	h := prometheus.NewHistogramVec(opts, labels)
+	f.registry.MustRegister(h)
+	return h
+}
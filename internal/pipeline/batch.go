@@ -0,0 +1,228 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/callmemars1/ytdlp-http/internal/jobs"
+	"github.com/callmemars1/ytdlp-http/internal/requestid"
+	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
+	"go.uber.org/zap"
+)
+
+// BatchRequest submits many uploads at once. Each item is an UploadRequest;
+// fields an item leaves out are taken from Defaults, with objects such as
+// options merged key by key.
+type BatchRequest struct {
+	Items       []json.RawMessage `json:"items" binding:"required"`
+	Defaults    json.RawMessage   `json:"defaults,omitempty"`
+	Concurrency int               `json:"concurrency,omitempty"`
+
+	// SubscriptionID links batches queued by a subscription run.
+	SubscriptionID string `json:"-"`
+}
+
+// ItemError is a batch item that failed validation.
+type ItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("items[%d]: %v", e.Index, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// queuedUpload is a job waiting to run in the background.
+type queuedUpload struct {
+	job *jobs.Job
+	req *UploadRequest
+}
+
+// SubmitBatch validates every item, records the batch and runs its items in
+// the background, at most Concurrency at a time.
+func (s *Service) SubmitBatch(ctx context.Context, req *BatchRequest, requester Requester) (*jobs.Batch, error) {
+	if s.draining.Err() != nil {
+		return nil, ytdlp.ErrShuttingDown
+	}
+
+	concurrency, items, err := s.prepareBatch(ctx, req, requester)
+	if err != nil {
+		return nil, err
+	}
+	batchJobs := make([]*jobs.Job, len(items))
+	for i, item := range items {
+		batchJobs[i] = item.job
+	}
+
+	batch := &jobs.Batch{
+		Requester:      requester.Name,
+		RequestID:      requestid.FromContext(ctx),
+		Concurrency:    concurrency,
+		SubscriptionID: req.SubscriptionID,
+	}
+	if err := s.jobStore.CreateBatch(ctx, batch, batchJobs); err != nil {
+		return nil, &Error{Code: "internal_error", Message: "Failed to record batch", Err: err}
+	}
+
+	s.logger.Info("Batch submitted",
+		zap.String("batch_id", batch.ID),
+		zap.Int("items", len(items)),
+		zap.Int("concurrency", concurrency))
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		s.runBatch(batch, items)
+	}()
+	return batch, nil
+}
+
+// ValidateBatch checks req as SubmitBatch would, without queueing anything.
+func (s *Service) ValidateBatch(ctx context.Context, req *BatchRequest, requester Requester) error {
+	_, _, err := s.prepareBatch(ctx, req, requester)
+	return err
+}
+
+// DefaultOptions returns the download options in a batch's defaults, with
+// credentials resolved for url on behalf of requester.
+func (s *Service) DefaultOptions(defaults json.RawMessage, url string, requester Requester) (*ytdlp.Options, error) {
+	var req UploadRequest
+	if len(defaults) > 0 {
+		if err := json.Unmarshal(defaults, &req); err != nil {
+			return nil, fmt.Errorf("%w: defaults: %v", ErrInvalidRequest, err)
+		}
+	}
+	if err := ResolveCredentials(s.credentialStore, url, req.Options, requester.Scopes); err != nil {
+		return nil, err
+	}
+	return req.Options, nil
+}
+
+// prepareBatch validates req and turns its items into jobs to be queued.
+func (s *Service) prepareBatch(ctx context.Context, req *BatchRequest, requester Requester) (int, []*queuedUpload, error) {
+	concurrency := req.Concurrency
+	if concurrency == 0 {
+		concurrency = s.config.BatchConcurrency
+	}
+	if concurrency < 1 || concurrency > s.config.BatchMaxConcurrency {
+		return 0, nil, fmt.Errorf("%w: concurrency must be between 1 and %d", ErrInvalidRequest, s.config.BatchMaxConcurrency)
+	}
+	if len(req.Items) == 0 || len(req.Items) > s.config.BatchMaxItems {
+		return 0, nil, fmt.Errorf("%w: a batch must have between 1 and %d items", ErrInvalidRequest, s.config.BatchMaxItems)
+	}
+
+	uploads, err := req.uploadRequests()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	items := make([]*queuedUpload, len(uploads))
+	for i, upload := range uploads {
+		if err := s.Validate(upload); err != nil {
+			return 0, nil, &ItemError{Index: i, Err: err}
+		}
+		if err := ResolveCredentials(s.credentialStore, upload.URL, upload.Options, requester.Scopes); err != nil {
+			return 0, nil, &ItemError{Index: i, Err: err}
+		}
+		items[i] = &queuedUpload{
+			job: &jobs.Job{
+				Kind:      jobs.KindUpload,
+				Requester: requester.Name,
+				Scopes:    requester.Scopes,
+				RequestID: requestid.FromContext(ctx),
+				URL:       upload.URL,
+				Request:   redactedRequest(upload),
+			},
+			req: upload,
+		}
+	}
+	return concurrency, items, nil
+}
+
+// runBatch runs items in order with batch.Concurrency workers. Items not
+// started before shutdown stay queued and are interrupted on the next start.
+func (s *Service) runBatch(batch *jobs.Batch, items []*queuedUpload) {
+	queue := make(chan *queuedUpload)
+	var wg sync.WaitGroup
+	for range min(batch.Concurrency, len(items)) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range queue {
+				if s.draining.Err() != nil {
+					continue
+				}
+				s.resume(item.job, item.req)
+			}
+		}()
+	}
+
+feed:
+	for _, item := range items {
+		select {
+		case queue <- item:
+		case <-s.draining.Done():
+			break feed
+		}
+	}
+	close(queue)
+	wg.Wait()
+
+	s.logger.Info("Batch finished", zap.String("batch_id", batch.ID), zap.Bool("stopped", s.draining.Err() != nil))
+}
+
+// uploadRequests merges every item over the defaults.
+func (r *BatchRequest) uploadRequests() ([]*UploadRequest, error) {
+	var defaults map[string]any
+	if len(r.Defaults) > 0 {
+		if err := json.Unmarshal(r.Defaults, &defaults); err != nil {
+			return nil, fmt.Errorf("%w: defaults: %v", ErrInvalidRequest, err)
+		}
+	}
+
+	uploads := make([]*UploadRequest, len(r.Items))
+	for i, raw := range r.Items {
+		var item map[string]any
+		if err := json.Unmarshal(raw, &item); err != nil {
+			return nil, &ItemError{Index: i, Err: fmt.Errorf("%w: %v", ErrInvalidRequest, err)}
+		}
+
+		data, err := json.Marshal(mergeObjects(defaults, item))
+		if err != nil {
+			return nil, &ItemError{Index: i, Err: fmt.Errorf("%w: %v", ErrInvalidRequest, err)}
+		}
+		var upload UploadRequest
+		if err := json.Unmarshal(data, &upload); err != nil {
+			return nil, &ItemError{Index: i, Err: fmt.Errorf("%w: %v", ErrInvalidRequest, err)}
+		}
+		if upload.URL == "" || upload.S3Key == "" {
+			return nil, &ItemError{Index: i, Err: fmt.Errorf("%w: url and s3_key are required", ErrInvalidRequest)}
+		}
+		uploads[i] = &upload
+	}
+	return uploads, nil
+}
+
+// mergeObjects returns base with override applied on top. Nested objects are
+// merged; any other value in override replaces the one in base.
+func mergeObjects(base, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		baseObject, baseOK := merged[key].(map[string]any)
+		overrideObject, overrideOK := value.(map[string]any)
+		if baseOK && overrideOK {
+			value = mergeObjects(baseObject, overrideObject)
+		}
+		merged[key] = value
+	}
+	return merged
+}
@@ -0,0 +1,62 @@
+package pipeline
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestMergeObjects(t *testing.T) {
+	tests := []struct {
+		name     string
+		base     string
+		override string
+		want     string
+	}{
+		{"empty", `{}`, `{}`, `{}`},
+		{"base only", `{"s3_key":"a"}`, `{}`, `{"s3_key":"a"}`},
+		{"override wins", `{"timeout":60}`, `{"timeout":120}`, `{"timeout":120}`},
+		{
+			"nested objects merge",
+			`{"options":{"quality":"720","proxy_pool":"eu"}}`,
+			`{"options":{"quality":"1080"}}`,
+			`{"options":{"proxy_pool":"eu","quality":"1080"}}`,
+		},
+		{
+			"deeply nested",
+			`{"options":{"extra_args":{"retries":"3"}}}`,
+			`{"options":{"extra_args":{"source-address":"1.2.3.4"}}}`,
+			`{"options":{"extra_args":{"retries":"3","source-address":"1.2.3.4"}}}`,
+		},
+		{"object replaced by value", `{"options":{"quality":"720"}}`, `{"options":null}`, `{"options":null}`},
+		{"value replaced by object", `{"options":"x"}`, `{"options":{"quality":"720"}}`, `{"options":{"quality":"720"}}`},
+		{"arrays are replaced", `{"tags":["a","b"]}`, `{"tags":["c"]}`, `{"tags":["c"]}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var base, override map[string]any
+			if err := json.Unmarshal([]byte(tt.base), &base); err != nil {
+				t.Fatal(err)
+			}
+			if err := json.Unmarshal([]byte(tt.override), &override); err != nil {
+				t.Fatal(err)
+			}
+			got, err := json.Marshal(mergeObjects(base, override))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("mergeObjects = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeObjectsKeepsBase(t *testing.T) {
+	var base map[string]any
+	json.Unmarshal([]byte(`{"options":{"quality":"720"}}`), &base)
+
+	mergeObjects(base, map[string]any{"options": map[string]any{"quality": "1080"}})
+	if got := base["options"].(map[string]any)["quality"]; got != "720" {
+		t.Errorf("base was modified: quality = %v", got)
+	}
+}
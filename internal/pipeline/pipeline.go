@@ -0,0 +1,594 @@
+package pipeline
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/credentials"
+	"github.com/callmemars1/ytdlp-http/internal/jobs"
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/requestid"
+	"github.com/callmemars1/ytdlp-http/internal/s3"
+	"github.com/callmemars1/ytdlp-http/internal/transcode"
+	"github.com/callmemars1/ytdlp-http/internal/utils"
+	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidRequest = errors.New("invalid request")
+
+const defaultUploadTimeout = 10 * time.Minute
+
+// cancelGrace bounds how long Shutdown waits for cancelled jobs to record
+// their outcome before the job store is closed.
+const cancelGrace = 5 * time.Second
+
+// Error is a failure after the download succeeded: in post-processing or
+// while uploading.
+type Error struct {
+	Code    string
+	Message string
+	Err     error
+}
+
+func (e *Error) Error() string {
+	return e.Message + ": " + e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+type UploadRequest struct {
+	URL     string                `json:"url" binding:"required"`
+	S3Key   string                `json:"s3_key" binding:"required"`
+	Options *ytdlp.Options        `json:"options,omitempty"`
+	Profile string                `json:"profile,omitempty"`
+	Output  string                `json:"output,omitempty"`
+	HLS     *transcode.HLSOptions `json:"hls,omitempty"`
+	Timeout int                   `json:"timeout,omitempty"`
+
+	// Archive overrides JOBS_ARCHIVE: whether to skip videos already
+	// uploaded to the same destination.
+	Archive *bool `json:"archive,omitempty"`
+}
+
+type UploadResult struct {
+	JobID    string
+	Upload   *s3.UploadResult
+	Format   *ytdlp.FormatSelection
+	Attempts int
+
+	// Skipped is set instead of Upload when nothing was uploaded, like
+	// SkipAlreadyArchived.
+	Skipped string
+}
+
+// SkipAlreadyArchived is reported for videos already uploaded to the same
+// destination, or being uploaded there by another job.
+const SkipAlreadyArchived = "already_archived"
+
+// Requester identifies who a job runs on behalf of.
+type Requester struct {
+	Name   string
+	Scopes []string
+}
+
+// Service runs uploads outside of any single HTTP request and records every
+// job in the job store.
+type Service struct {
+	config           *configurations.JobsConfig
+	ytdlpService     *ytdlp.Service
+	s3Service        *s3.Service
+	transcodeService *transcode.Service
+	credentialStore  *credentials.Store
+	jobStore         *jobs.Store
+	logger           *zap.Logger
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	// draining is cancelled on shutdown so that no further queued jobs start.
+	draining     context.Context
+	stopDraining context.CancelFunc
+}
+
+func NewService(cfg *configurations.JobsConfig, ytdlpService *ytdlp.Service, s3Service *s3.Service, transcodeService *transcode.Service, credentialStore *credentials.Store, jobStore *jobs.Store, logger *zap.Logger) *Service {
+	ctx, cancel := context.WithCancel(context.Background())
+	draining, stopDraining := context.WithCancel(ctx)
+	return &Service{
+		config:           cfg,
+		ytdlpService:     ytdlpService,
+		s3Service:        s3Service,
+		transcodeService: transcodeService,
+		credentialStore:  credentialStore,
+		jobStore:         jobStore,
+		logger:           logger,
+		ctx:              ctx,
+		cancel:           cancel,
+		draining:         draining,
+		stopDraining:     stopDraining,
+	}
+}
+
+// ResolveCredentials attaches the credential profile named in options for
+// url, on behalf of an API key holding scopes.
+func ResolveCredentials(store *credentials.Store, url string, options *ytdlp.Options, scopes []string) error {
+	if options == nil || options.Credentials == "" {
+		return nil
+	}
+
+	profile, err := store.Resolve(options.Credentials, url, scopes)
+	if err != nil {
+		return err
+	}
+	options.CredentialProfile = profile
+	return nil
+}
+
+// Validate checks req against the configured profiles.
+func (s *Service) Validate(req *UploadRequest) error {
+	if req.Profile != "" {
+		if _, err := s.transcodeService.Profile(req.Profile); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+		}
+	}
+
+	switch req.Output {
+	case "", "file", "hls":
+	default:
+		return fmt.Errorf("%w: output must be file or hls", ErrInvalidRequest)
+	}
+	if err := req.HLS.Validate(); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidRequest, err)
+	}
+	return nil
+}
+
+// Upload downloads req.URL, post-processes it and uploads it to S3,
+// recording the run as a job.
+func (s *Service) Upload(ctx context.Context, req *UploadRequest, requester Requester) (*UploadResult, error) {
+	if err := s.Validate(req); err != nil {
+		return nil, err
+	}
+	if err := ResolveCredentials(s.credentialStore, req.URL, req.Options, requester.Scopes); err != nil {
+		return nil, err
+	}
+
+	job := &jobs.Job{
+		Kind:      jobs.KindUpload,
+		Requester: requester.Name,
+		Scopes:    requester.Scopes,
+		RequestID: requestid.FromContext(ctx),
+		URL:       req.URL,
+		Request:   redactedRequest(req),
+	}
+	if err := s.jobStore.Create(ctx, job); err != nil {
+		return nil, err
+	}
+
+	result, err := s.run(ctx, job, req)
+	if result != nil {
+		result.JobID = job.ID
+	}
+	return result, err
+}
+
+// Start marks jobs left over from a previous run as interrupted and, if
+// configured, runs interrupted uploads again in the background.
+func (s *Service) Start(ctx context.Context) error {
+	interrupted, err := s.jobStore.Interrupt(ctx)
+	if err != nil {
+		return err
+	}
+	if len(interrupted) > 0 {
+		s.logger.Warn("Marked jobs left running by a previous run as interrupted", zap.Int("jobs", len(interrupted)))
+	}
+	if !s.config.RequeueInterrupted {
+		return nil
+	}
+
+	batches := make(map[string][]*queuedUpload)
+	for _, job := range interrupted {
+		if job.Kind != jobs.KindUpload {
+			continue
+		}
+		var req UploadRequest
+		if err := json.Unmarshal(job.Request, &req); err != nil {
+			s.logger.Error("Failed to decode interrupted job, not re-queueing", zap.Error(err), zap.String("job_id", job.ID))
+			continue
+		}
+		// Only the redacted request is stored; running it again would use the
+		// masked proxy credentials.
+		if req.Options.HasRedactedSecrets() {
+			s.logger.Warn("Interrupted job had redacted proxy credentials, not re-queueing", zap.String("job_id", job.ID))
+			continue
+		}
+		if err := s.jobStore.Requeue(ctx, job); err != nil {
+			return err
+		}
+		if job.BatchID != "" {
+			batches[job.BatchID] = append(batches[job.BatchID], &queuedUpload{job: job, req: &req})
+			continue
+		}
+
+		s.logger.Info("Re-queued interrupted upload", zap.String("job_id", job.ID), zap.String("url", job.URL))
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.resume(job, &req)
+		}()
+	}
+
+	// Batch items go back through their batch so its concurrency still holds.
+	for id, items := range batches {
+		batch, err := s.jobStore.GetBatch(ctx, id)
+		if err != nil {
+			return err
+		}
+		slices.SortFunc(items, func(a, b *queuedUpload) int {
+			return a.job.BatchIndex - b.job.BatchIndex
+		})
+
+		s.logger.Info("Re-queued interrupted batch", zap.String("batch_id", id), zap.Int("items", len(items)))
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.runBatch(batch, items)
+		}()
+	}
+	return nil
+}
+
+// Shutdown stops starting queued jobs and waits for running ones to finish.
+// Jobs still running when ctx expires are cancelled, and given cancelGrace to
+// record their outcome.
+func (s *Service) Shutdown(ctx context.Context) error {
+	s.stopDraining()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		s.cancel()
+		select {
+		case <-done:
+		case <-time.After(cancelGrace):
+			s.logger.Warn("Jobs still running after cancellation")
+		}
+		return ctx.Err()
+	}
+}
+
+func (s *Service) resume(job *jobs.Job, req *UploadRequest) {
+	ctx, logger := s.ctx, s.logger
+	if job.RequestID != "" {
+		ctx = requestid.NewContext(ctx, job.RequestID)
+		logger = logger.With(zap.String("request_id", job.RequestID))
+	}
+	ctx = logging.NewContext(ctx, logger)
+
+	if err := ResolveCredentials(s.credentialStore, req.URL, req.Options, job.Scopes); err != nil {
+		s.finish(ctx, job, nil, nil, err)
+		return
+	}
+	if err := s.jobStore.Start(ctx, job); err != nil {
+		logger.Error("Failed to start queued job", zap.Error(err), zap.String("job_id", job.ID))
+		return
+	}
+	if _, err := s.run(ctx, job, req); err != nil {
+		logger.Error("Queued upload failed", zap.Error(err), zap.String("job_id", job.ID))
+	}
+}
+
+func (s *Service) run(ctx context.Context, job *jobs.Job, req *UploadRequest) (*UploadResult, error) {
+	logger := logging.FromContext(ctx, s.logger).With(zap.String("job_id", job.ID))
+	ctx = logging.NewContext(ctx, logger)
+
+	timeout := time.Duration(req.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = defaultUploadTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	logger.Info("Starting video download and S3 upload",
+		zap.String("url", req.URL),
+		zap.String("s3_key", req.S3Key))
+
+	if destination := s.archiveDestination(req); destination != "" {
+		// The video is looked up first, so that its archive entry can be
+		// reserved before anything is downloaded.
+		info, err := s.ytdlpService.GetVideoInfo(ctx, req.URL, req.Options)
+		if err != nil {
+			s.finish(ctx, job, nil, nil, err)
+			return nil, err
+		}
+
+		entry := info.ArchiveEntry()
+		if entry == "" {
+			logger.Warn("Video info has no extractor and ID, uploading without the download archive")
+		} else {
+			reserved, err := s.jobStore.ReserveArchive(ctx, destination, entry, job.ID)
+			if err != nil {
+				logger.Error("Failed to reserve download archive entry", zap.Error(err))
+				err = &Error{Code: "internal_error", Message: "Failed to reserve download archive entry", Err: err}
+				s.finish(ctx, job, nil, nil, err)
+				return nil, err
+			}
+			if !reserved {
+				logger.Info("Video is already archived, skipping upload",
+					zap.String("url", req.URL),
+					zap.String("destination", destination),
+					zap.String("entry", entry))
+				s.skip(ctx, job, info, SkipAlreadyArchived)
+				return &UploadResult{Skipped: job.Skipped}, nil
+			}
+			defer s.settleArchive(ctx, destination, entry, job)
+		}
+	}
+
+	download, err := s.ytdlpService.DownloadVideo(ctx, req.URL, req.Options)
+	if err != nil {
+		logger.Error("Failed to download video", zap.Error(err), zap.String("url", req.URL))
+		s.finish(ctx, job, nil, nil, err)
+		return nil, err
+	}
+	filePath := download.FilePath
+	defer func() {
+		if cleanupErr := s.ytdlpService.CleanupFile(filePath); cleanupErr != nil {
+			logger.Error("Failed to cleanup file", zap.Error(cleanupErr), zap.String("file", filePath))
+		}
+	}()
+
+	extraMetadata := map[string]interface{}{
+		"job_id": job.ID,
+	}
+	if req.Profile != "" {
+		outputPath, applied, err := s.transcodeService.Apply(ctx, download.FilePath, req.Profile)
+		if err != nil {
+			logger.Error("Failed to apply output profile", zap.Error(err), zap.String("profile", req.Profile))
+			err = &Error{Code: "transcode_failed", Message: "Failed to apply output profile", Err: err}
+			s.finish(ctx, job, download, nil, err)
+			return nil, err
+		}
+		download.FilePath = outputPath
+		extraMetadata["output_profile"] = applied
+	}
+
+	var uniqueKey string
+	var uploadResult *s3.UploadResult
+	if req.Output == "hls" {
+		packaged, err := s.transcodeService.PackageHLS(ctx, download.FilePath, req.HLS)
+		if err != nil {
+			logger.Error("Failed to package HLS", zap.Error(err), zap.String("file", download.FilePath))
+			err = &Error{Code: "hls_failed", Message: "Failed to package HLS", Err: err}
+			s.finish(ctx, job, download, nil, err)
+			return nil, err
+		}
+		extraMetadata["hls"] = packaged
+
+		uniqueKey = generateUniqueS3Key(strings.TrimSuffix(req.S3Key, filepath.Ext(req.S3Key)), "")
+		uploadResult, err = s.s3Service.UploadHLSWithMetadata(ctx, download, packaged, uniqueKey, extraMetadata)
+	} else {
+		uniqueKey = generateUniqueS3Key(req.S3Key, download.FilePath)
+		uploadResult, err = s.s3Service.UploadVideoWithMetadata(ctx, download, uniqueKey, extraMetadata)
+	}
+	if err != nil {
+		logger.Error("Failed to upload to S3", zap.Error(err),
+			zap.String("file", filePath),
+			zap.String("s3_key", uniqueKey))
+		err = &Error{Code: "upload_failed", Message: "Failed to upload to S3", Err: err}
+		s.finish(ctx, job, download, nil, err)
+		return nil, err
+	}
+
+	logger.Info("Video uploaded successfully to S3",
+		zap.String("video_key", uploadResult.VideoUpload.Key),
+		zap.String("metadata_key", uploadResult.MetadataUpload.Key),
+		zap.Int64("total_size", uploadResult.TotalSize))
+
+	s.finish(ctx, job, download, uploadResult, nil)
+	return &UploadResult{
+		Upload:   uploadResult,
+		Format:   download.Format,
+		Attempts: download.Attempts,
+	}, nil
+}
+
+// finish records the outcome of an upload job. It runs even if ctx has
+// expired, so that timed out jobs are not left running.
+func (s *Service) finish(ctx context.Context, job *jobs.Job, download *ytdlp.DownloadResult, upload *s3.UploadResult, err error) {
+	Complete(job, download, err)
+	if upload != nil {
+		job.Size = upload.TotalSize
+		job.S3Keys = UploadedKeys(upload)
+	}
+	if storeErr := s.jobStore.Finish(context.WithoutCancel(ctx), job); storeErr != nil {
+		logging.FromContext(ctx, s.logger).Error("Failed to record job outcome", zap.Error(storeErr), zap.String("job_id", job.ID))
+	}
+}
+
+// archiveDestination names the download archive req is checked against. It
+// is empty if archiving is off.
+func (s *Service) archiveDestination(req *UploadRequest) string {
+	enabled := s.config.Archive
+	if req.Archive != nil {
+		enabled = *req.Archive
+	}
+	if !enabled {
+		return ""
+	}
+	return archiveScope(s.s3Service.Bucket(), req.S3Key)
+}
+
+// archiveScope returns the archive for uploads of s3Key to bucket: the bucket
+// and the folder part of the requested key. Uploaded objects are named after
+// the whole sanitized key at the bucket root, so the folder is a namespace
+// of the request rather than an S3 prefix; the archive is checked before the
+// download, when the final key is not known yet.
+func archiveScope(bucket, s3Key string) string {
+	return path.Join(bucket, path.Dir(strings.TrimLeft(s3Key, "/")))
+}
+
+// settleArchive archives the entry the job reserved if its upload
+// succeeded, and releases it otherwise.
+func (s *Service) settleArchive(ctx context.Context, destination, entry string, job *jobs.Job) {
+	ctx = context.WithoutCancel(ctx)
+	var err error
+	if job.Status == jobs.StatusSucceeded {
+		err = s.jobStore.CommitArchive(ctx, destination, entry, job.ID)
+	} else {
+		err = s.jobStore.ReleaseArchive(ctx, destination, entry, job.ID)
+	}
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Error("Failed to update download archive", zap.Error(err), zap.String("job_id", job.ID))
+	}
+}
+
+// skip records that job ended without uploading anything, for reason.
+func (s *Service) skip(ctx context.Context, job *jobs.Job, info *ytdlp.VideoInfo, reason string) {
+	Complete(job, &ytdlp.DownloadResult{Info: info}, nil)
+	job.Status = jobs.StatusSkipped
+	job.Skipped = reason
+	if err := s.jobStore.Finish(context.WithoutCancel(ctx), job); err != nil {
+		logging.FromContext(ctx, s.logger).Error("Failed to record job outcome", zap.Error(err), zap.String("job_id", job.ID))
+	}
+}
+
+// Complete fills in job's outcome from a download and the error that ended
+// the job, if any.
+func Complete(job *jobs.Job, download *ytdlp.DownloadResult, err error) {
+	if download != nil {
+		job.Attempts = download.Attempts
+		if download.Info != nil {
+			job.Title = download.Info.Title
+			job.Extractor = download.Info.Extractor
+			job.VideoID = download.Info.ID
+			job.Uploader = download.Info.Uploader
+			job.Description = download.Info.Description
+			job.Tags = download.Info.Tags
+		}
+	}
+
+	if err == nil {
+		job.Status = jobs.StatusSucceeded
+		return
+	}
+	job.Status = jobs.StatusFailed
+	job.ErrorCode = ErrorCode(err)
+	job.ErrorMessage = ErrorMessage(err)
+
+	var ytdlpErr *ytdlp.Error
+	if errors.As(err, &ytdlpErr) && job.Attempts == 0 {
+		job.Attempts = ytdlpErr.Attempts
+	}
+}
+
+// ErrorCode returns the stable error code reported for err.
+func ErrorCode(err error) string {
+	var ytdlpErr *ytdlp.Error
+	var pipelineErr *Error
+	switch {
+	case errors.As(err, &ytdlpErr):
+		return string(ytdlpErr.Code)
+	case errors.As(err, &pipelineErr):
+		return pipelineErr.Code
+	case errors.Is(err, ErrInvalidRequest), errors.Is(err, ytdlp.ErrInvalidOptions):
+		return "bad_request"
+	case errors.Is(err, credentials.ErrScopeDenied):
+		return "forbidden"
+	case errors.Is(err, credentials.ErrUnknownProfile), errors.Is(err, credentials.ErrSiteNotAllowed):
+		return "bad_request"
+	case errors.Is(err, ytdlp.ErrShuttingDown):
+		return "shutting_down"
+	case errors.Is(err, context.DeadlineExceeded):
+		return string(ytdlp.CodeTimeout)
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	default:
+		return string(ytdlp.CodeDownloadFailed)
+	}
+}
+
+// ErrorMessage returns the message stored and reported for err. Like the
+// HTTP responses, it never includes wrapped raw errors, which may hold yt-dlp
+// output, storage errors or local paths.
+func ErrorMessage(err error) string {
+	var ytdlpErr *ytdlp.Error
+	var pipelineErr *Error
+	switch {
+	case errors.As(err, &ytdlpErr):
+		return ytdlpErr.Message
+	case errors.As(err, &pipelineErr):
+		return pipelineErr.Message
+	case errors.Is(err, ErrInvalidRequest), errors.Is(err, ytdlp.ErrInvalidOptions),
+		errors.Is(err, credentials.ErrScopeDenied), errors.Is(err, credentials.ErrUnknownProfile),
+		errors.Is(err, credentials.ErrSiteNotAllowed):
+		return err.Error()
+	case errors.Is(err, ytdlp.ErrShuttingDown):
+		return "Server is shutting down"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "Job timed out"
+	case errors.Is(err, context.Canceled):
+		return "Job was canceled"
+	default:
+		return "Failed to download video"
+	}
+}
+
+// UploadedKeys lists every object an upload created.
+func UploadedKeys(upload *s3.UploadResult) []string {
+	var keys []string
+	add := func(file *s3.FileUploadResult) {
+		if file != nil {
+			keys = append(keys, file.Key)
+		}
+	}
+	if upload.HLS != nil {
+		// The master playlist is the video upload and among the HLS keys.
+		keys = append(keys, upload.HLS.Keys...)
+	} else {
+		add(upload.VideoUpload)
+	}
+	add(upload.MetadataUpload)
+	add(upload.ThumbnailUpload)
+	for _, subtitle := range upload.SubtitleUploads {
+		add(subtitle)
+	}
+	return keys
+}
+
+func redactedRequest(req *UploadRequest) json.RawMessage {
+	redacted := *req
+	redacted.Options = req.Options.Redacted()
+	data, _ := json.Marshal(&redacted)
+	return data
+}
+
+func generateUniqueS3Key(requestedKey, filePath string) string {
+	ext := filepath.Ext(filePath)
+
+	if filepath.Ext(requestedKey) == "" {
+		requestedKey = requestedKey + ext
+	}
+
+	safeName := utils.SanitizeFilename(requestedKey)
+	return utils.GenerateUniqueKey(safeName)
+}
@@ -0,0 +1,93 @@
+package pipeline
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"testing"
+
+	"github.com/callmemars1/ytdlp-http/internal/s3"
+	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
+)
+
+func TestErrorMessage(t *testing.T) {
+	raw := errors.New("open /tmp/ytdlp-123/secret title.mp4: no such file")
+
+	tests := []struct {
+		name string
+		err  error
+		want string
+	}{
+		{"yt-dlp error", &ytdlp.Error{Code: ytdlp.CodeRateLimited, Message: "Site is rate limiting downloads", Output: "ERROR: 429"}, "Site is rate limiting downloads"},
+		{"pipeline error", &Error{Code: "upload_failed", Message: "Failed to upload to S3", Err: raw}, "Failed to upload to S3"},
+		{"wrapped pipeline error", fmt.Errorf("job: %w", &Error{Code: "upload_failed", Message: "Failed to upload to S3", Err: raw}), "Failed to upload to S3"},
+		{"invalid request", fmt.Errorf("%w: s3_key is required", ErrInvalidRequest), ErrInvalidRequest.Error() + ": s3_key is required"},
+		{"timeout", fmt.Errorf("waiting: %w", context.DeadlineExceeded), "Job timed out"},
+		{"raw error", raw, "Failed to download video"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ErrorMessage(tt.err); got != tt.want {
+				t.Errorf("ErrorMessage = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUploadedKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		upload *s3.UploadResult
+		want   []string
+	}{
+		{
+			name: "file",
+			upload: &s3.UploadResult{
+				VideoUpload:     &s3.FileUploadResult{Key: "v.mp4"},
+				MetadataUpload:  &s3.FileUploadResult{Key: "v.json"},
+				SubtitleUploads: []*s3.FileUploadResult{{Key: "v.en.vtt"}},
+				ThumbnailUpload: &s3.FileUploadResult{Key: "v.jpg"},
+			},
+			want: []string{"v.mp4", "v.json", "v.jpg", "v.en.vtt"},
+		},
+		{
+			name: "hls",
+			upload: &s3.UploadResult{
+				VideoUpload:    &s3.FileUploadResult{Key: "v/master.m3u8"},
+				MetadataUpload: &s3.FileUploadResult{Key: "v/master.json"},
+				HLS: &s3.HLSUpload{Keys: []string{
+					"v/master.m3u8", "v/720p/index.m3u8", "v/720p/init.mp4", "v/720p/seg_000.m4s",
+				}},
+			},
+			want: []string{"v/master.m3u8", "v/720p/index.m3u8", "v/720p/init.mp4", "v/720p/seg_000.m4s", "v/master.json"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := UploadedKeys(tt.upload); !slices.Equal(got, tt.want) {
+				t.Errorf("UploadedKeys = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestArchiveScope(t *testing.T) {
+	tests := []struct {
+		key  string
+		want string
+	}{
+		{"video", "bucket"},
+		{"video.mp4", "bucket"},
+		{"channels/example/abc", "bucket/channels/example"},
+		{"channels/example/def.mp4", "bucket/channels/example"},
+		{"/channels/example/abc", "bucket/channels/example"},
+		{"channels//example/abc", "bucket/channels/example"},
+		{"channels/other/abc", "bucket/channels/other"},
+	}
+	for _, tt := range tests {
+		if got := archiveScope("bucket", tt.key); got != tt.want {
+			t.Errorf("archiveScope(%q) = %q, want %q", tt.key, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,292 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"go.uber.org/zap"
+)
+
+var ErrUnknownPool = errors.New("unknown proxy pool")
+
+const (
+	StrategyRoundRobin = "round-robin"
+	StrategySticky     = "sticky"
+)
+
+// blockedPattern matches yt-dlp errors caused by the site refusing the
+// egress IP rather than by the video itself.
+var blockedPattern = regexp.MustCompile(`HTTP Error (403|429)`)
+
+type PoolConfig struct {
+	Name     string   `json:"name"`
+	Strategy string   `json:"strategy,omitempty"`
+	Proxies  []string `json:"proxies"`
+}
+
+type Proxy struct {
+	URL      string
+	redacted string
+	pool     *pool
+
+	failures       int
+	unhealthyUntil time.Time
+}
+
+type pool struct {
+	name     string
+	strategy string
+	proxies  []*Proxy
+	next     int
+}
+
+// Manager hands out proxies from named pools and tracks their health.
+type Manager struct {
+	config *configurations.ProxyConfig
+	logger *zap.Logger
+
+	mu    sync.Mutex
+	pools map[string]*pool
+}
+
+func NewManager(cfg *configurations.ProxyConfig, logger *zap.Logger) (*Manager, error) {
+	manager := &Manager{
+		config: cfg,
+		logger: logger,
+		pools:  make(map[string]*pool),
+	}
+	if cfg.PoolsFile == "" {
+		return manager, nil
+	}
+
+	data, err := os.ReadFile(cfg.PoolsFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read proxy pools: %w", err)
+	}
+
+	var configs []PoolConfig
+	if err := json.Unmarshal(data, &configs); err != nil {
+		return nil, fmt.Errorf("failed to parse proxy pools: %w", err)
+	}
+
+	for _, poolConfig := range configs {
+		p, err := newPool(poolConfig)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy pool %q: %w", poolConfig.Name, err)
+		}
+		manager.pools[p.name] = p
+		logger.Info("Loaded proxy pool",
+			zap.String("pool", p.name),
+			zap.String("strategy", p.strategy),
+			zap.Int("proxies", len(p.proxies)))
+	}
+
+	if cfg.DefaultPool != "" && manager.pools[cfg.DefaultPool] == nil {
+		return nil, fmt.Errorf("%w: default pool %s", ErrUnknownPool, cfg.DefaultPool)
+	}
+
+	return manager, nil
+}
+
+func newPool(cfg PoolConfig) (*pool, error) {
+	if cfg.Name == "" {
+		return nil, errors.New("name is required")
+	}
+	if len(cfg.Proxies) == 0 {
+		return nil, errors.New("at least one proxy is required")
+	}
+
+	p := &pool{name: cfg.Name, strategy: cfg.Strategy}
+	switch p.strategy {
+	case "":
+		p.strategy = StrategyRoundRobin
+	case StrategyRoundRobin, StrategySticky:
+	default:
+		return nil, fmt.Errorf("unknown strategy %s", cfg.Strategy)
+	}
+
+	for _, raw := range cfg.Proxies {
+		parsed, err := url.Parse(raw)
+		if err != nil || parsed.Host == "" {
+			// Do not echo the entry, it may contain credentials.
+			return nil, fmt.Errorf("proxy #%d is not a valid URL", len(p.proxies)+1)
+		}
+		p.proxies = append(p.proxies, &Proxy{
+			URL:      raw,
+			redacted: redactURL(parsed),
+			pool:     p,
+		})
+	}
+	return p, nil
+}
+
+// Validate reports whether name refers to a configured pool. An empty name
+// selects the default pool, if any.
+func (m *Manager) Validate(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := m.pools[name]; !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownPool, name)
+	}
+	return nil
+}
+
+// Pick returns a proxy from the named pool, or the default pool when name is
+// empty, for fetching rawURL. It returns nil when no pool applies.
+func (m *Manager) Pick(name, rawURL string) (*Proxy, error) {
+	if name == "" {
+		name = m.config.DefaultPool
+	}
+	if name == "" {
+		return nil, nil
+	}
+
+	p, ok := m.pools[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownPool, name)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	candidates := make([]*Proxy, 0, len(p.proxies))
+	for _, proxy := range p.proxies {
+		if now.After(proxy.unhealthyUntil) {
+			candidates = append(candidates, proxy)
+		}
+	}
+	if len(candidates) == 0 {
+		m.logger.Warn("All proxies in pool are unhealthy, using them anyway", zap.String("pool", p.name))
+		candidates = p.proxies
+	}
+
+	if p.strategy == StrategySticky {
+		host := rawURL
+		if parsed, err := url.Parse(rawURL); err == nil && parsed.Hostname() != "" {
+			host = strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+		}
+		hash := fnv.New32a()
+		hash.Write([]byte(host))
+		return candidates[hash.Sum32()%uint32(len(candidates))], nil
+	}
+
+	proxy := candidates[p.next%len(candidates)]
+	p.next++
+	return proxy, nil
+}
+
+// Report records the outcome of a yt-dlp run through proxy. Runs failing with
+// 403 or 429 count against the proxy; after FailureThreshold consecutive
+// failures it is skipped for Cooldown.
+func (m *Manager) Report(proxy *Proxy, output string, err error) {
+	if proxy == nil {
+		return
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if err == nil {
+		proxy.failures = 0
+		return
+	}
+	if !blockedPattern.MatchString(output) {
+		return
+	}
+
+	proxy.failures++
+	if proxy.failures >= m.config.FailureThreshold {
+		proxy.unhealthyUntil = time.Now().Add(m.config.Cooldown)
+		proxy.failures = 0
+		m.logger.Warn("Marking proxy unhealthy",
+			zap.String("pool", proxy.pool.name),
+			zap.String("proxy", proxy.redacted),
+			zap.Duration("cooldown", m.config.Cooldown))
+	}
+}
+
+// String returns the proxy URL with credentials removed.
+func (p *Proxy) String() string {
+	return p.redacted
+}
+
+// Redact replaces every occurrence of the proxy URL and its password in s.
+func (p *Proxy) Redact(s string) string {
+	if p == nil {
+		return s
+	}
+	return redact(s, p.URL, p.redacted)
+}
+
+// RedactURL removes credentials from a proxy URL given on the command line.
+// yt-dlp also accepts proxies without a scheme, like user:pass@host:port.
+func RedactURL(raw string) string {
+	parsed, bare, err := parseURL(raw)
+	if err != nil {
+		return "xxxxx"
+	}
+	if bare {
+		return strings.TrimPrefix(redactURL(parsed), "//")
+	}
+	return redactURL(parsed)
+}
+
+// RedactIn replaces every occurrence of the proxy URL raw, given on the
+// command line, and of its password in s.
+func RedactIn(s, raw string) string {
+	return redact(s, raw, RedactURL(raw))
+}
+
+func redact(s, raw, redacted string) string {
+	s = strings.ReplaceAll(s, raw, redacted)
+	if parsed, _, err := parseURL(raw); err == nil && parsed.User != nil {
+		if password, ok := parsed.User.Password(); ok && password != "" {
+			s = strings.ReplaceAll(s, password, "xxxxx")
+		}
+	}
+	return s
+}
+
+// parseURL parses a proxy URL, reporting whether it had no scheme.
+func parseURL(raw string) (*url.URL, bool, error) {
+	if !strings.Contains(raw, "://") {
+		parsed, err := url.Parse("//" + raw)
+		return parsed, true, err
+	}
+	parsed, err := url.Parse(raw)
+	return parsed, false, err
+}
+
+// IsRedactedURL reports whether raw is the output of RedactURL for a URL
+// that had its credentials masked, so the original can no longer be used.
+func IsRedactedURL(raw string) bool {
+	if raw == "xxxxx" {
+		return true
+	}
+	parsed, _, err := parseURL(raw)
+	if err != nil || parsed.User == nil {
+		return false
+	}
+	_, hasPassword := parsed.User.Password()
+	return parsed.User.Username() == "xxxxx" && !hasPassword
+}
+
+func redactURL(u *url.URL) string {
+	if u.User == nil {
+		return u.String()
+	}
+	redacted := *u
+	redacted.User = url.User("xxxxx")
+	return redacted.String()
+}
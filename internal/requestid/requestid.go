@@ -0,0 +1,39 @@
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+// Header carries the request ID in both directions.
+const Header = "X-Request-ID"
+
+type contextKey struct{}
+
+// Accepted client-supplied IDs; anything else is replaced by a generated one
+// so that untrusted input never ends up in logs or object metadata verbatim.
+var validID = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// New returns a random 128-bit hex request ID.
+func New() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// Valid reports whether a client-supplied ID may be reused.
+func Valid(id string) bool {
+	return validID.MatchString(id)
+}
+
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the request ID stored in ctx, or "".
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
@@ -0,0 +1,118 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+var (
+	errTransient = errors.New("transient")
+	errFatal     = errors.New("fatal")
+)
+
+func isTransient(err error) bool {
+	return errors.Is(err, errTransient)
+}
+
+func TestDo(t *testing.T) {
+	policy := Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond, MaxBackoff: 2 * time.Millisecond}
+
+	tests := []struct {
+		name         string
+		policy       Policy
+		results      []error
+		wantAttempts int
+		wantErr      error
+		wantRetries  int
+	}{
+		{"success", policy, []error{nil}, 1, nil, 0},
+		{"success after retries", policy, []error{errTransient, errTransient, nil}, 3, nil, 2},
+		{"exhausted", policy, []error{errTransient, errTransient, errTransient}, 3, errTransient, 2},
+		{"not retryable", policy, []error{errFatal}, 1, errFatal, 0},
+		{"not retryable after retry", policy, []error{errTransient, errFatal}, 2, errFatal, 1},
+		{"single attempt", Policy{MaxAttempts: 1}, []error{errTransient}, 1, errTransient, 0},
+		{"zero attempts means one", Policy{}, []error{errTransient}, 1, errTransient, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retries := 0
+			attempts, err := Do(context.Background(), tt.policy, isTransient,
+				func(attempt int, delay time.Duration, err error) {
+					retries++
+					if delay <= 0 || (tt.policy.MaxBackoff > 0 && delay > tt.policy.MaxBackoff) {
+						t.Errorf("retry %d delay = %v", attempt, delay)
+					}
+				},
+				func(attempt int) error {
+					return tt.results[attempt-1]
+				})
+			if attempts != tt.wantAttempts {
+				t.Errorf("attempts = %d, want %d", attempts, tt.wantAttempts)
+			}
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("err = %v, want %v", err, tt.wantErr)
+			}
+			if retries != tt.wantRetries {
+				t.Errorf("onRetry called %d times, want %d", retries, tt.wantRetries)
+			}
+		})
+	}
+}
+
+func TestDoStopsAtDeadline(t *testing.T) {
+	policy := Policy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+
+	attempts, err := Do(ctx, policy, isTransient, func(int, time.Duration, error) {
+		t.Error("retried although the backoff runs past the deadline")
+	}, func(int) error {
+		return errTransient
+	})
+	if attempts != 1 || !errors.Is(err, errTransient) {
+		t.Errorf("attempts = %d, err = %v, want 1 and the last error", attempts, err)
+	}
+}
+
+func TestDoStopsWhenCancelled(t *testing.T) {
+	policy := Policy{MaxAttempts: 5, InitialBackoff: time.Hour, MaxBackoff: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+
+	attempts, err := Do(ctx, policy, isTransient, func(int, time.Duration, error) {
+		cancel()
+	}, func(int) error {
+		return errTransient
+	})
+	if attempts != 1 || !errors.Is(err, errTransient) {
+		t.Errorf("attempts = %d, err = %v, want 1 and the last error", attempts, err)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := Policy{InitialBackoff: 100 * time.Millisecond, MaxBackoff: time.Second}
+
+	tests := []struct {
+		attempt int
+		max     time.Duration
+	}{
+		{1, 100 * time.Millisecond},
+		{2, 200 * time.Millisecond},
+		{3, 400 * time.Millisecond},
+		{5, time.Second},
+		{70, time.Second},
+	}
+	for _, tt := range tests {
+		for range 100 {
+			delay := policy.backoff(tt.attempt)
+			if delay <= 0 || delay > tt.max {
+				t.Fatalf("backoff(%d) = %v, want in (0, %v]", tt.attempt, delay, tt.max)
+			}
+		}
+	}
+
+	if delay := (Policy{}).backoff(1); delay != 0 {
+		t.Errorf("backoff without a policy = %v, want 0", delay)
+	}
+}
@@ -5,36 +5,71 @@ import (
 	"context"
 	"crypto/md5"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/http"
 	"os"
+	"path"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
 	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/metrics"
+	"github.com/callmemars1/ytdlp-http/internal/requestid"
+	"github.com/callmemars1/ytdlp-http/internal/retry"
+	"github.com/callmemars1/ytdlp-http/internal/tracing"
+	"github.com/callmemars1/ytdlp-http/internal/transcode"
 	"github.com/callmemars1/ytdlp-http/internal/utils"
 	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+const treeUploadConcurrency = 4
+
+var tracer = otel.Tracer("github.com/callmemars1/ytdlp-http/internal/s3")
+
 type Service struct {
-	client *s3.Client
-	config *configurations.S3Config
-	logger *zap.Logger
+	client  *s3.Client
+	presign *s3.PresignClient
+	config  *configurations.S3Config
+	logger  *zap.Logger
+	metrics *metrics.Metrics
 }
 
 type UploadResult struct {
-	VideoUpload    *FileUploadResult `json:"video_upload"`
-	MetadataUpload *FileUploadResult `json:"metadata_upload"`
+	VideoUpload     *FileUploadResult   `json:"video_upload"`
+	MetadataUpload  *FileUploadResult   `json:"metadata_upload"`
+	SubtitleUploads []*FileUploadResult `json:"subtitle_uploads,omitempty"`
+	ThumbnailUpload *FileUploadResult   `json:"thumbnail_upload,omitempty"`
+	HLS             *HLSUpload          `json:"hls,omitempty"`
 	TotalSize      int64             `json:"total_size"`
 	UploadedAt     time.Time         `json:"uploaded_at"`
 }
 
+type HLSUpload struct {
+	Prefix            string `json:"prefix"`
+	MasterPlaylistURL string `json:"master_playlist_url"`
+	Files             int    `json:"files"`
+	Size              int64  `json:"size"`
+
+	// Keys of every playlist and segment, including the master playlist.
+	Keys []string `json:"-"`
+}
+
 type FileUploadResult struct {
 	Key         string `json:"key"`
 	Bucket      string `json:"bucket"`
@@ -43,9 +78,10 @@ type FileUploadResult struct {
 	Size        int64  `json:"size"`
 	ContentType string `json:"content_type"`
 	MD5Hash     string `json:"md5_hash"`
+	Attempts    int    `json:"attempts"`
 }
 
-func NewService(cfg *configurations.S3Config, logger *zap.Logger) (*Service, error) {
+func NewService(cfg *configurations.S3Config, logger *zap.Logger, m *metrics.Metrics) (*Service, error) {
 	customResolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
 		return aws.Endpoint{
 			URL:               cfg.Endpoint,
@@ -68,48 +104,225 @@ func NewService(cfg *configurations.S3Config, logger *zap.Logger) (*Service, err
 
 	client := s3.NewFromConfig(awsConfig, func(o *s3.Options) {
 		o.UsePathStyle = true
+		// putObject retries on its own, so don't stack the SDK's retries on top.
+		o.Retryer = aws.NopRetryer{}
+		// Trace every S3 request and propagate the trace context to the endpoint.
+		if buildable, ok := awsConfig.HTTPClient.(*awshttp.BuildableClient); ok {
+			o.HTTPClient = &http.Client{
+				Transport: otelhttp.NewTransport(buildable.GetTransport()),
+				Timeout:   buildable.GetTimeout(),
+			}
+		}
 	})
 
 	return &Service{
-		client: client,
-		config: cfg,
-		logger: logger,
+		client:  client,
+		presign: s3.NewPresignClient(client),
+		config:  cfg,
+		logger:  logger,
+		metrics: m,
 	}, nil
 }
 
-func (s *Service) UploadVideoWithMetadata(ctx context.Context, filePath, key string, videoInfo *ytdlp.VideoInfo) (*UploadResult, error) {
-	s.logger.Info("Starting video and metadata upload", zap.String("file", filePath), zap.String("key", key))
+// UploadVideoWithMetadata uploads the media file, its sidecars and a metadata
+// JSON. extraMetadata is merged into the metadata JSON.
+func (s *Service) UploadVideoWithMetadata(ctx context.Context, download *ytdlp.DownloadResult, key string, extraMetadata map[string]interface{}) (*UploadResult, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	filePath := download.FilePath
+	logger.Info("Starting video and metadata upload", zap.String("file", filePath), zap.String("key", key))
 
 	videoResult, err := s.uploadFile(ctx, filePath, key)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload video: %w", err)
 	}
 
-	metadataKey := s.getMetadataKey(key)
-	metadataResult, err := s.uploadMetadata(ctx, metadataKey, videoInfo, filepath.Base(filePath))
+	return s.uploadSidecars(ctx, download, videoResult, []string{key}, extraMetadata)
+}
+
+// UploadHLSWithMetadata uploads a packaged HLS tree under prefix. Sidecars and
+// the metadata JSON are placed next to the master playlist, which is returned
+// as the video upload.
+func (s *Service) UploadHLSWithMetadata(ctx context.Context, download *ytdlp.DownloadResult, hls *transcode.HLSResult, prefix string, extraMetadata map[string]interface{}) (*UploadResult, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("Starting HLS and metadata upload", zap.String("dir", hls.Dir), zap.String("prefix", prefix))
+
+	files, err := s.UploadTree(ctx, hls.Dir, prefix)
 	if err != nil {
-		s.logger.Error("Failed to upload metadata, cleaning up video", zap.Error(err))
-		if delErr := s.DeleteFile(ctx, key); delErr != nil {
-			s.logger.Error("Failed to cleanup video after metadata upload failure", zap.Error(delErr))
+		return nil, fmt.Errorf("failed to upload HLS tree: %w", err)
+	}
+
+	masterKey := path.Join(prefix, hls.MasterPlaylist)
+	var masterResult *FileUploadResult
+	uploadedKeys := make([]string, 0, len(files))
+	hlsUpload := &HLSUpload{Prefix: prefix, Files: len(files)}
+	for _, file := range files {
+		uploadedKeys = append(uploadedKeys, file.Key)
+		hlsUpload.Keys = append(hlsUpload.Keys, file.Key)
+		hlsUpload.Size += file.Size
+		if file.Key == masterKey {
+			masterResult = file
+		}
+	}
+	if masterResult == nil {
+		s.deleteKeys(ctx, uploadedKeys)
+		return nil, fmt.Errorf("master playlist %s not found in HLS output", hls.MasterPlaylist)
+	}
+	hlsUpload.MasterPlaylistURL = masterResult.Location
+
+	result, err := s.uploadSidecars(ctx, download, masterResult, uploadedKeys, extraMetadata)
+	if err != nil {
+		return nil, err
+	}
+	result.HLS = hlsUpload
+	result.TotalSize += hlsUpload.Size - masterResult.Size
+	return result, nil
+}
+
+// uploadSidecars uploads subtitles, the thumbnail and the metadata JSON next to
+// an already uploaded primary object. On failure every key in uploadedKeys is
+// removed again.
+func (s *Service) uploadSidecars(ctx context.Context, download *ytdlp.DownloadResult, primary *FileUploadResult, uploadedKeys []string, extraMetadata map[string]interface{}) (*UploadResult, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	key := primary.Key
+	cleanup := func() {
+		// The request context may be cancelled already, cleanup must still run.
+		s.deleteKeys(context.WithoutCancel(ctx), uploadedKeys)
+	}
+
+	var subtitleResults []*FileUploadResult
+	for _, subtitle := range download.Subtitles {
+		subtitleResult, err := s.uploadFile(ctx, subtitle.Path, s.getSubtitleKey(key, subtitle))
+		if err != nil {
+			logger.Error("Failed to upload subtitles, cleaning up", zap.Error(err), zap.String("language", subtitle.Language))
+			cleanup()
+			return nil, fmt.Errorf("failed to upload subtitles: %w", err)
+		}
+		uploadedKeys = append(uploadedKeys, subtitleResult.Key)
+		subtitleResults = append(subtitleResults, subtitleResult)
+	}
+
+	var thumbnailResult *FileUploadResult
+	if download.ThumbnailPath != "" {
+		thumbnailKey := strings.TrimSuffix(key, filepath.Ext(key)) + filepath.Ext(download.ThumbnailPath)
+		var err error
+		thumbnailResult, err = s.uploadFile(ctx, download.ThumbnailPath, thumbnailKey)
+		if err != nil {
+			logger.Error("Failed to upload thumbnail, cleaning up", zap.Error(err))
+			cleanup()
+			return nil, fmt.Errorf("failed to upload thumbnail: %w", err)
 		}
+		uploadedKeys = append(uploadedKeys, thumbnailKey)
+	}
+
+	metadataKey := s.getMetadataKey(key)
+	metadataResult, err := s.uploadMetadata(ctx, metadataKey, download.Info, filepath.Base(download.FilePath), subtitleResults, thumbnailResult, extraMetadata)
+	if err != nil {
+		logger.Error("Failed to upload metadata, cleaning up video", zap.Error(err))
+		cleanup()
 		return nil, fmt.Errorf("failed to upload metadata: %w", err)
 	}
 
 	result := &UploadResult{
-		VideoUpload:    videoResult,
-		MetadataUpload: metadataResult,
-		TotalSize:      videoResult.Size + metadataResult.Size,
-		UploadedAt:     time.Now(),
+		VideoUpload:     primary,
+		MetadataUpload:  metadataResult,
+		SubtitleUploads: subtitleResults,
+		ThumbnailUpload: thumbnailResult,
+		TotalSize:       primary.Size + metadataResult.Size,
+		UploadedAt:      time.Now(),
+	}
+	for _, subtitleResult := range subtitleResults {
+		result.TotalSize += subtitleResult.Size
+	}
+	if thumbnailResult != nil {
+		result.TotalSize += thumbnailResult.Size
 	}
 
-	s.logger.Info("Video and metadata uploaded successfully", 
+	logger.Info("Video and metadata uploaded successfully", 
 		zap.String("video_key", key),
 		zap.String("metadata_key", metadataKey),
+		zap.Int("subtitles", len(subtitleResults)),
 		zap.Int64("total_size", result.TotalSize))
 
 	return result, nil
 }
 
+// UploadTree uploads every regular file under dir to prefix, keeping the
+// relative layout. Already uploaded objects are removed if any upload fails.
+func (s *Service) UploadTree(ctx context.Context, dir, prefix string) ([]*FileUploadResult, error) {
+	var paths []string
+	err := filepath.WalkDir(dir, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.Type().IsRegular() {
+			paths = append(paths, filePath)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list %s: %w", dir, err)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		firstErr error
+		results  = make([]*FileUploadResult, len(paths))
+		next     = make(chan int)
+	)
+	for i := 0; i < treeUploadConcurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for index := range next {
+				rel, _ := filepath.Rel(dir, paths[index])
+				result, err := s.uploadFile(ctx, paths[index], path.Join(prefix, filepath.ToSlash(rel)))
+				mu.Lock()
+				if err != nil && firstErr == nil {
+					firstErr = fmt.Errorf("failed to upload %s: %w", rel, err)
+					cancel()
+				}
+				results[index] = result
+				mu.Unlock()
+			}
+		}()
+	}
+	for index := range paths {
+		if ctx.Err() != nil {
+			break
+		}
+		next <- index
+	}
+	close(next)
+	wg.Wait()
+
+	if firstErr != nil {
+		var uploadedKeys []string
+		for _, result := range results {
+			if result != nil {
+				uploadedKeys = append(uploadedKeys, result.Key)
+			}
+		}
+		// The request context may be cancelled already, cleanup must still run.
+		s.deleteKeys(context.WithoutCancel(ctx), uploadedKeys)
+		return nil, firstErr
+	}
+
+	return results, nil
+}
+
+func (s *Service) deleteKeys(ctx context.Context, keys []string) {
+	logger := logging.FromContext(ctx, s.logger)
+	for _, key := range keys {
+		if delErr := s.DeleteFile(ctx, key); delErr != nil {
+			logger.Error("Failed to cleanup object after upload failure", zap.Error(delErr), zap.String("key", key))
+		}
+	}
+}
+
 func (s *Service) uploadFile(ctx context.Context, filePath, key string) (*FileUploadResult, error) {
 	file, err := os.Open(filePath)
 	if err != nil {
@@ -124,8 +337,11 @@ func (s *Service) uploadFile(ctx context.Context, filePath, key string) (*FileUp
 
 	contentType := utils.GetContentType(filePath)
 	
+	_, span := tracer.Start(ctx, "s3.md5", trace.WithAttributes(attribute.Int64("s3.size", stat.Size())))
 	hash := md5.New()
-	if _, err := io.Copy(hash, file); err != nil {
+	_, err = io.Copy(hash, file)
+	tracing.End(span, err)
+	if err != nil {
 		return nil, fmt.Errorf("failed to calculate MD5 hash: %w", err)
 	}
 	md5Hash := fmt.Sprintf("%x", hash.Sum(nil))
@@ -146,9 +362,9 @@ func (s *Service) uploadFile(ctx context.Context, filePath, key string) (*FileUp
 		},
 	}
 
-	result, err := s.client.PutObject(ctx, input)
+	result, attempts, err := s.putObject(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to upload to S3-compatible storage: %w", err)
+		return nil, fmt.Errorf("failed to upload to S3-compatible storage after %d attempt(s): %w", attempts, err)
 	}
 
 	location := fmt.Sprintf("%s/%s/%s", s.config.Endpoint, s.config.Bucket, key)
@@ -161,19 +377,35 @@ func (s *Service) uploadFile(ctx context.Context, filePath, key string) (*FileUp
 		Size:        stat.Size(),
 		ContentType: contentType,
 		MD5Hash:     md5Hash,
+		Attempts:    attempts,
 	}, nil
 }
 
-func (s *Service) uploadMetadata(ctx context.Context, key string, videoInfo *ytdlp.VideoInfo, originalFilename string) (*FileUploadResult, error) {
+func (s *Service) uploadMetadata(ctx context.Context, key string, videoInfo *ytdlp.VideoInfo, originalFilename string, subtitles []*FileUploadResult, thumbnail *FileUploadResult, extraMetadata map[string]interface{}) (*FileUploadResult, error) {
 	metadata := map[string]interface{}{
 		"original_filename": originalFilename,
 		"upload_timestamp":  time.Now().Format(time.RFC3339),
 	}
+	for name, value := range extraMetadata {
+		metadata[name] = value
+	}
 
 	if videoInfo != nil {
 		metadata["video_info"] = videoInfo
 	}
 
+	if len(subtitles) > 0 {
+		subtitleKeys := make([]string, 0, len(subtitles))
+		for _, subtitle := range subtitles {
+			subtitleKeys = append(subtitleKeys, subtitle.Key)
+		}
+		metadata["subtitle_keys"] = subtitleKeys
+	}
+
+	if thumbnail != nil {
+		metadata["thumbnail_key"] = thumbnail.Key
+	}
+
 	jsonData, err := json.MarshalIndent(metadata, "", "  ")
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
@@ -195,9 +427,9 @@ func (s *Service) uploadMetadata(ctx context.Context, key string, videoInfo *ytd
 		},
 	}
 
-	result, err := s.client.PutObject(ctx, input)
+	result, attempts, err := s.putObject(ctx, input)
 	if err != nil {
-		return nil, fmt.Errorf("failed to upload metadata to S3-compatible storage: %w", err)
+		return nil, fmt.Errorf("failed to upload metadata to S3-compatible storage after %d attempt(s): %w", attempts, err)
 	}
 
 	location := fmt.Sprintf("%s/%s/%s", s.config.Endpoint, s.config.Bucket, key)
@@ -210,10 +442,105 @@ func (s *Service) uploadMetadata(ctx context.Context, key string, videoInfo *ytd
 		Size:        int64(len(jsonData)),
 		ContentType: "application/json",
 		MD5Hash:     md5Hash,
+		Attempts:    attempts,
 	}, nil
 }
 
+// maxRetryBackoff caps the wait between PutObject attempts.
+const maxRetryBackoff = 10 * time.Second
+
+// putObject uploads input, tagged with the request ID from ctx, retrying
+// transient failures as long as the body can be rewound. It returns the number
+// of attempts made.
+func (s *Service) putObject(ctx context.Context, input *s3.PutObjectInput) (*s3.PutObjectOutput, int, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	policy := retry.Policy{
+		MaxAttempts:    s.config.RetryAttempts,
+		InitialBackoff: s.config.RetryBackoff,
+		MaxBackoff:     maxRetryBackoff,
+	}
+	if id := requestid.FromContext(ctx); id != "" {
+		if input.Metadata == nil {
+			input.Metadata = map[string]string{}
+		}
+		input.Metadata["request-id"] = id
+	}
+
+	body, seekable := input.Body.(io.Seeker)
+	if !seekable {
+		policy.MaxAttempts = 1
+	}
+
+	ctx, span := tracer.Start(ctx, "s3.PutObject", trace.WithAttributes(
+		attribute.String("s3.bucket", aws.ToString(input.Bucket)),
+		attribute.String("s3.key", aws.ToString(input.Key)),
+		attribute.Int64("s3.size", aws.ToInt64(input.ContentLength)),
+	))
+	var result *s3.PutObjectOutput
+	attempts, err := retry.Do(ctx, policy, isRetryable, func(attempt int, delay time.Duration, err error) {
+		logger.Warn("Retrying S3 upload", 
+			zap.String("key", aws.ToString(input.Key)),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", delay),
+			zap.Error(err))
+	}, func(attempt int) error {
+		if attempt > 1 {
+			if _, err := body.Seek(0, io.SeekStart); err != nil {
+				return fmt.Errorf("failed to rewind upload body: %w", err)
+			}
+		}
+
+		started := time.Now()
+		var err error
+		result, err = s.client.PutObject(ctx, input)
+		s.metrics.S3UploadDuration.Observe(time.Since(started).Seconds())
+		if err != nil {
+			s.metrics.S3UploadErrors.Inc()
+		}
+		return err
+	})
+	span.SetAttributes(attribute.Int("s3.attempts", attempts))
+	tracing.End(span, err)
+	if err != nil {
+		return nil, attempts, err
+	}
+
+	s.metrics.S3UploadBytes.Add(float64(aws.ToInt64(input.ContentLength)))
+	return result, attempts, nil
+}
+
+// isRetryable reports whether a failed S3 call is worth repeating: network
+// errors, throttling and server-side failures are; anything else is not.
+func isRetryable(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	var response interface{ HTTPStatusCode() int }
+	if !errors.As(err, &response) {
+		return true
+	}
+	status := response.HTTPStatusCode()
+	return status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+}
+
+// Bucket is the name of the bucket uploads go to.
+func (s *Service) Bucket() string {
+	return s.config.Bucket
+}
+
+// Ping verifies that the configured bucket exists and is reachable.
+func (s *Service) Ping(ctx context.Context) error {
+	_, err := s.client.HeadBucket(ctx, &s3.HeadBucketInput{
+		Bucket: aws.String(s.config.Bucket),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to reach bucket %s: %w", s.config.Bucket, err)
+	}
+	return nil
+}
+
 func (s *Service) DeleteFile(ctx context.Context, key string) error {
+	logger := logging.FromContext(ctx, s.logger)
 	input := &s3.DeleteObjectInput{
 		Bucket: aws.String(s.config.Bucket),
 		Key:    aws.String(key),
@@ -221,14 +548,30 @@ func (s *Service) DeleteFile(ctx context.Context, key string) error {
 
 	_, err := s.client.DeleteObject(ctx, input)
 	if err != nil {
-		s.logger.Error("Failed to delete object from S3-compatible storage", zap.Error(err), zap.String("key", key))
+		logger.Error("Failed to delete object from S3-compatible storage", zap.Error(err), zap.String("key", key))
 		return fmt.Errorf("failed to delete object: %w", err)
 	}
 
-	s.logger.Info("File deleted from S3-compatible storage", zap.String("key", key))
+	logger.Info("File deleted from S3-compatible storage", zap.String("key", key))
 	return nil
 }
 
+// PresignGet returns a time-limited GET URL for key. A ttl of zero uses the
+// configured default.
+func (s *Service) PresignGet(ctx context.Context, key string, ttl time.Duration) (string, error) {
+	if ttl <= 0 {
+		ttl = s.config.PresignTTL
+	}
+	request, err := s.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.config.Bucket),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", fmt.Errorf("failed to presign %s: %w", key, err)
+	}
+	return request.URL, nil
+}
+
 func (s *Service) DeleteVideoAndMetadata(ctx context.Context, videoKey string) error {
 	metadataKey := s.getMetadataKey(videoKey)
 	
@@ -249,6 +592,16 @@ func (s *Service) DeleteVideoAndMetadata(ctx context.Context, videoKey string) e
 	return nil
 }
 
+// getSubtitleKey places subtitles next to the video as "<base>.<lang>.<ext>".
+func (s *Service) getSubtitleKey(videoKey string, subtitle ytdlp.SubtitleFile) string {
+	base := strings.TrimSuffix(videoKey, filepath.Ext(videoKey))
+	ext := filepath.Ext(subtitle.Path)
+	if subtitle.Language == "" {
+		return base + ext
+	}
+	return base + "." + utils.SanitizeFilename(subtitle.Language) + ext
+}
+
 func (s *Service) getMetadataKey(videoKey string) string {
 	ext := filepath.Ext(videoKey)
 	base := strings.TrimSuffix(videoKey, ext)
@@ -0,0 +1,62 @@
+package apierror
+
+import (
+	"net/http"
+
+	"github.com/callmemars1/ytdlp-http/internal/requestid"
+	"github.com/gin-gonic/gin"
+)
+
+const debugKey = "apierror_debug"
+
+// Response is the body of every error returned by the API.
+type Response struct {
+	Code      string      `json:"code"`
+	Message   string      `json:"message"`
+	RequestID string      `json:"request_id,omitempty"`
+	Details   interface{} `json:"details,omitempty"`
+	Retryable bool        `json:"retryable"`
+}
+
+// Debug makes Details visible in error responses when enabled.
+func Debug(enabled bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if enabled {
+			c.Set(debugKey, true)
+		}
+		c.Next()
+	}
+}
+
+// Abort responds with an error and stops the handler chain.
+func Abort(c *gin.Context, status int, code, message string) {
+	AbortWithDetails(c, status, code, message, nil)
+}
+
+// AbortWithDetails is Abort with diagnostic details, which are only sent when
+// debug is enabled.
+func AbortWithDetails(c *gin.Context, status int, code, message string, details interface{}) {
+	response := Response{
+		Code:      code,
+		Message:   message,
+		RequestID: requestid.FromContext(c.Request.Context()),
+		Retryable: Retryable(status),
+	}
+	if c.GetBool(debugKey) {
+		response.Details = details
+	}
+	c.AbortWithStatusJSON(status, response)
+}
+
+// Retryable reports whether a request failing with status may succeed when
+// retried unchanged.
+func Retryable(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
@@ -7,3 +7,9 @@ type Handler interface {
 
 	Handle(c *gin.Context)
 }
+
+// PublicHandler is implemented by handlers that also expose routes
+// which must be reachable without API key authentication.
+type PublicHandler interface {
+	SetupPublicRoute(router gin.IRouter)
+}
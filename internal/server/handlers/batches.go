@@ -0,0 +1,258 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/jobs"
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/pipeline"
+	"github.com/callmemars1/ytdlp-http/internal/server/apierror"
+	"github.com/callmemars1/ytdlp-http/internal/server/middlewares"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type BatchHandler struct {
+	pipelineService *pipeline.Service
+	jobStore        *jobs.Store
+	logger          *zap.Logger
+}
+
+type BatchResponse struct {
+	*jobs.Batch
+	Status     string        `json:"status"`
+	FinishedAt *time.Time    `json:"finished_at,omitempty"`
+	Progress   BatchProgress `json:"progress"`
+	Items      []*BatchItem  `json:"items"`
+}
+
+type BatchProgress struct {
+	Total       int     `json:"total"`
+	Queued      int     `json:"queued"`
+	Running     int     `json:"running"`
+	Succeeded   int     `json:"succeeded"`
+	Failed      int     `json:"failed"`
+	Interrupted int     `json:"interrupted"`
+	Skipped     int     `json:"skipped"`
+	Percent     float64 `json:"percent"`
+	Size        int64   `json:"size"`
+}
+
+type BatchItem struct {
+	Index        int         `json:"index"`
+	JobID        string      `json:"job_id"`
+	URL          string      `json:"url"`
+	Status       jobs.Status `json:"status"`
+	Title        string      `json:"title,omitempty"`
+	VideoID      string      `json:"video_id,omitempty"`
+	Size         int64       `json:"size"`
+	Attempts     int         `json:"attempts"`
+	S3Keys       []string    `json:"s3_keys,omitempty"`
+	ErrorCode    string      `json:"error_code,omitempty"`
+	ErrorMessage string      `json:"error_message,omitempty"`
+	Skipped      string      `json:"skipped,omitempty"`
+	StartedAt    *time.Time  `json:"started_at,omitempty"`
+	FinishedAt   *time.Time  `json:"finished_at,omitempty"`
+}
+
+var batchReportHeader = []string{
+	"index", "job_id", "url", "status", "title", "video_id", "size", "attempts",
+	"s3_keys", "error_code", "error_message", "skipped", "started_at", "finished_at",
+}
+
+func NewBatchHandler(pipelineService *pipeline.Service, jobStore *jobs.Store, logger *zap.Logger) *BatchHandler {
+	return &BatchHandler{
+		pipelineService: pipelineService,
+		jobStore:        jobStore,
+		logger:          logger,
+	}
+}
+
+func (h *BatchHandler) SetupRoute(router gin.IRouter) {
+	router.POST("/batches", h.Handle)
+	router.GET("/batches/:id", h.HandleGet)
+	router.GET("/batches/:id/report", h.HandleReport)
+}
+
+func (h *BatchHandler) Handle(c *gin.Context) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	var req pipeline.BatchRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Warn("Invalid batch request", zap.Error(err))
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", "Invalid request body: "+err.Error())
+		return
+	}
+
+	logger.Info("Received batch request",
+		zap.Int("items", len(req.Items)),
+		zap.String("client_ip", c.ClientIP()))
+
+	batch, err := h.pipelineService.SubmitBatch(c.Request.Context(), &req, pipeline.Requester{
+		Name:   middlewares.KeyName(c),
+		Scopes: middlewares.Scopes(c),
+	})
+	if err != nil {
+		abortUploadError(c, err)
+		return
+	}
+
+	response, ok := h.batchResponse(c, batch.ID)
+	if !ok {
+		return
+	}
+	c.Header("Location", "/batches/"+batch.ID)
+	c.JSON(http.StatusAccepted, response)
+}
+
+func (h *BatchHandler) HandleGet(c *gin.Context) {
+	response, ok := h.batchResponse(c, c.Param("id"))
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, response)
+}
+
+// HandleReport serves the per-item results as a CSV or JSON attachment.
+func (h *BatchHandler) HandleReport(c *gin.Context) {
+	format := c.DefaultQuery("format", "csv")
+	if format != "csv" && format != "json" {
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", "format must be csv or json")
+		return
+	}
+
+	response, ok := h.batchResponse(c, c.Param("id"))
+	if !ok {
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="batch-%s.%s"`, response.ID, format))
+	if format == "json" {
+		c.JSON(http.StatusOK, response.Items)
+		return
+	}
+
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Status(http.StatusOK)
+	writer := csv.NewWriter(c.Writer)
+	writer.Write(batchReportHeader)
+	for _, item := range response.Items {
+		writer.Write([]string{
+			strconv.Itoa(item.Index),
+			item.JobID,
+			reportCell(item.URL),
+			string(item.Status),
+			reportCell(item.Title),
+			reportCell(item.VideoID),
+			strconv.FormatInt(item.Size, 10),
+			strconv.Itoa(item.Attempts),
+			reportCell(strings.Join(item.S3Keys, " ")),
+			item.ErrorCode,
+			reportCell(item.ErrorMessage),
+			item.Skipped,
+			formatReportTime(item.StartedAt),
+			formatReportTime(item.FinishedAt),
+		})
+	}
+	writer.Flush()
+}
+
+// batchResponse loads a batch with its items. Batches of other API keys are
+// reported as not found to keys without the admin scope. It responds with an
+// error and returns false if that fails.
+func (h *BatchHandler) batchResponse(c *gin.Context, id string) (*BatchResponse, bool) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	batch, err := h.jobStore.GetBatch(c.Request.Context(), id)
+	if err == nil && !middlewares.CanAccess(c, batch.Requester) {
+		err = jobs.ErrNotFound
+	}
+	if errors.Is(err, jobs.ErrNotFound) {
+		apierror.Abort(c, http.StatusNotFound, "not_found", "Batch not found")
+		return nil, false
+	}
+	var batchJobs []*jobs.Job
+	if err == nil {
+		batchJobs, err = h.jobStore.BatchJobs(c.Request.Context(), id)
+	}
+	if err != nil {
+		logger.Error("Failed to load batch", zap.Error(err), zap.String("batch_id", id))
+		apierror.Abort(c, http.StatusInternalServerError, "internal_error", "Failed to load batch")
+		return nil, false
+	}
+
+	response := &BatchResponse{
+		Batch:  batch,
+		Status: "finished",
+		Items:  make([]*BatchItem, 0, len(batchJobs)),
+	}
+	progress := &response.Progress
+	for _, job := range batchJobs {
+		switch job.Status {
+		case jobs.StatusQueued:
+			progress.Queued++
+		case jobs.StatusRunning:
+			progress.Running++
+		case jobs.StatusSucceeded:
+			progress.Succeeded++
+		case jobs.StatusFailed:
+			progress.Failed++
+		case jobs.StatusInterrupted:
+			progress.Interrupted++
+		case jobs.StatusSkipped:
+			progress.Skipped++
+		}
+		progress.Size += job.Size
+		if job.FinishedAt != nil && (response.FinishedAt == nil || job.FinishedAt.After(*response.FinishedAt)) {
+			response.FinishedAt = job.FinishedAt
+		}
+
+		response.Items = append(response.Items, &BatchItem{
+			Index:        job.BatchIndex,
+			JobID:        job.ID,
+			URL:          job.URL,
+			Status:       job.Status,
+			Title:        job.Title,
+			VideoID:      job.VideoID,
+			Size:         job.Size,
+			Attempts:     job.Attempts,
+			S3Keys:       job.S3Keys,
+			ErrorCode:    job.ErrorCode,
+			ErrorMessage: job.ErrorMessage,
+			Skipped:      job.Skipped,
+			StartedAt:    job.StartedAt,
+			FinishedAt:   job.FinishedAt,
+		})
+	}
+
+	progress.Total = len(batchJobs)
+	done := progress.Succeeded + progress.Failed + progress.Interrupted + progress.Skipped
+	if progress.Total > 0 {
+		progress.Percent = float64(done*1000/progress.Total) / 10
+	}
+	if done < progress.Total {
+		response.Status = "running"
+		response.FinishedAt = nil
+	}
+	return response, true
+}
+
+// reportCell escapes text from outside the service that a spreadsheet would
+// otherwise evaluate as a formula.
+func reportCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+func formatReportTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
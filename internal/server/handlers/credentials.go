@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/callmemars1/ytdlp-http/internal/credentials"
+	"github.com/callmemars1/ytdlp-http/internal/pipeline"
+	"github.com/callmemars1/ytdlp-http/internal/server/apierror"
+	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
+	"github.com/gin-gonic/gin"
+)
+
+// resolveCredentials attaches the credential profile named in options for
+// url, on behalf of an API key holding scopes. It responds with an error and
+// returns false if the profile may not be used.
+func resolveCredentials(c *gin.Context, store *credentials.Store, url string, options *ytdlp.Options, scopes []string) bool {
+	if err := pipeline.ResolveCredentials(store, url, options, scopes); err != nil {
+		abortCredentialsError(c, err)
+		return false
+	}
+	return true
+}
+
+func abortCredentialsError(c *gin.Context, err error) {
+	if errors.Is(err, credentials.ErrScopeDenied) {
+		apierror.Abort(c, http.StatusForbidden, "forbidden", err.Error())
+	} else {
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", err.Error())
+	}
+}
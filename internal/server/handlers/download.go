@@ -1,12 +1,27 @@
 package handlers
 
 import (
+	"archive/zip"
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/callmemars1/ytdlp-http/internal/credentials"
+	"github.com/callmemars1/ytdlp-http/internal/jobs"
+	"github.com/callmemars1/ytdlp-http/internal/links"
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/pipeline"
+	"github.com/callmemars1/ytdlp-http/internal/requestid"
+	"github.com/callmemars1/ytdlp-http/internal/server/apierror"
+	"github.com/callmemars1/ytdlp-http/internal/server/middlewares"
+	"github.com/callmemars1/ytdlp-http/internal/transcode"
 	"github.com/callmemars1/ytdlp-http/internal/utils"
 	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
 	"github.com/gin-gonic/gin"
@@ -14,20 +29,30 @@ import (
 )
 
 type DownloadHandler struct {
-	ytdlpService *ytdlp.Service
-	logger       *zap.Logger
+	ytdlpService     *ytdlp.Service
+	linkService      *links.Service
+	transcodeService *transcode.Service
+	credentialStore  *credentials.Store
+	jobStore         *jobs.Store
+	logger           *zap.Logger
 }
 
 type DownloadRequest struct {
-	URL     string             `json:"url" binding:"required"`
-	Options *ytdlp.Options     `json:"options,omitempty"`
-	Timeout int                `json:"timeout,omitempty"`
+	URL              string         `json:"url" binding:"required"`
+	Options          *ytdlp.Options `json:"options,omitempty"`
+	Profile          string         `json:"profile,omitempty"`
+	Timeout          int            `json:"timeout,omitempty"`
+	IncludeSubtitles bool           `json:"include_subtitles,omitempty"`
 }
 
-func NewDownloadHandler(ytdlpService *ytdlp.Service, logger *zap.Logger) *DownloadHandler {
+func NewDownloadHandler(ytdlpService *ytdlp.Service, linkService *links.Service, transcodeService *transcode.Service, credentialStore *credentials.Store, jobStore *jobs.Store, logger *zap.Logger) *DownloadHandler {
 	return &DownloadHandler{
-		ytdlpService: ytdlpService,
-		logger:       logger,
+		ytdlpService:     ytdlpService,
+		linkService:      linkService,
+		transcodeService: transcodeService,
+		credentialStore:  credentialStore,
+		jobStore:         jobStore,
+		logger:           logger,
 	}
 }
 
@@ -35,17 +60,64 @@ func (h *DownloadHandler) SetupRoute(router gin.IRouter) {
 	router.POST("/download", h.Handle)
 }
 
+func (h *DownloadHandler) SetupPublicRoute(router gin.IRouter) {
+	router.GET("/d/:token", h.HandleLink)
+}
+
 func (h *DownloadHandler) Handle(c *gin.Context) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
 	var req DownloadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.logger.Warn("Invalid download request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, gin.H{
-			"error":   "bad_request",
-			"message": "Invalid request body: " + err.Error(),
-		})
+		logger.Warn("Invalid download request", zap.Error(err))
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", "Invalid request body: "+err.Error())
 		return
 	}
 
+	h.download(c, &req, middlewares.KeyName(c), middlewares.Scopes(c))
+}
+
+// HandleLink serves a download described by a signed link minted via POST /links.
+func (h *DownloadHandler) HandleLink(c *gin.Context) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	claims, err := h.linkService.Verify(c.Request.Context(), c.Param("token"), c.ClientIP())
+	if err != nil {
+		logger.Warn("Rejected download link", zap.Error(err), zap.String("client_ip", c.ClientIP()))
+		switch {
+		case errors.Is(err, links.ErrExpired), errors.Is(err, links.ErrRevoked):
+			apierror.Abort(c, http.StatusGone, "link_gone", err.Error())
+		case errors.Is(err, links.ErrInvalidToken), errors.Is(err, links.ErrIPMismatch):
+			apierror.Abort(c, http.StatusForbidden, "forbidden", err.Error())
+		default:
+			apierror.Abort(c, http.StatusInternalServerError, "internal_error", "Failed to verify download link")
+		}
+		return
+	}
+
+	logger.Info("Serving download link", zap.String("link_id", claims.ID))
+	h.download(c, &DownloadRequest{
+		URL:              claims.URL,
+		Options:          claims.Options,
+		Profile:          claims.Profile,
+		Timeout:          claims.Timeout,
+		IncludeSubtitles: claims.IncludeSubtitles,
+	}, claims.Requester, claims.Scopes)
+}
+
+// download serves req; requester and scopes are those of the API key the
+// request, or the link it came from, was authorized with.
+func (h *DownloadHandler) download(c *gin.Context, req *DownloadRequest, requester string, scopes []string) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	if !resolveCredentials(c, h.credentialStore, req.URL, req.Options, scopes) {
+		return
+	}
+
+	if req.Profile != "" {
+		if _, err := h.transcodeService.Profile(req.Profile); err != nil {
+			apierror.Abort(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+	}
+
 	timeout := time.Duration(req.Timeout) * time.Second
 	if timeout == 0 {
 		timeout = 5 * time.Minute
@@ -54,32 +126,85 @@ func (h *DownloadHandler) Handle(c *gin.Context) {
 	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
 	defer cancel()
 
-	h.logger.Info("Starting video download", 
+	job := &jobs.Job{
+		Kind:      jobs.KindDownload,
+		Requester: requester,
+		Scopes:    scopes,
+		RequestID: requestid.FromContext(ctx),
+		URL:       req.URL,
+		Request:   req.redacted(),
+	}
+	if err := h.jobStore.Create(ctx, job); err != nil {
+		logger.Error("Failed to record download job", zap.Error(err))
+		apierror.Abort(c, http.StatusInternalServerError, "internal_error", "Failed to record job")
+		return
+	}
+	logger = logger.With(zap.String("job_id", job.ID))
+	ctx = logging.NewContext(ctx, logger)
+	c.Header(jobIDHeader, job.ID)
+
+	var (
+		download *ytdlp.DownloadResult
+		jobErr   error
+	)
+	defer func() {
+		pipeline.Complete(job, download, jobErr)
+		if err := h.jobStore.Finish(context.WithoutCancel(ctx), job); err != nil {
+			logger.Error("Failed to record job outcome", zap.Error(err))
+		}
+	}()
+
+	logger.Info("Starting video download", 
 		zap.String("url", req.URL), 
 		zap.String("client_ip", c.ClientIP()))
 
-	filePath, videoInfo, err := h.ytdlpService.DownloadVideo(ctx, req.URL, req.Options)
+	download, err := h.ytdlpService.DownloadVideo(ctx, req.URL, req.Options)
 	if err != nil {
-		h.logger.Error("Failed to download video", zap.Error(err), zap.String("url", req.URL))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "download_failed",
-			"message": "Failed to download video: " + err.Error(),
-		})
+		jobErr = err
+		logger.Error("Failed to download video", zap.Error(err), zap.String("url", req.URL))
+		abortDownloadError(c, err)
 		return
 	}
 	defer func() {
-		if cleanupErr := h.ytdlpService.CleanupFile(filePath); cleanupErr != nil {
-			h.logger.Error("Failed to cleanup file", zap.Error(cleanupErr), zap.String("file", filePath))
+		if cleanupErr := h.ytdlpService.CleanupFile(download.FilePath); cleanupErr != nil {
+			logger.Error("Failed to cleanup file", zap.Error(cleanupErr), zap.String("file", download.FilePath))
 		}
 	}()
 
+	if req.Profile != "" {
+		outputPath, _, err := h.transcodeService.Apply(ctx, download.FilePath, req.Profile)
+		if err != nil {
+			jobErr = &pipeline.Error{Code: "transcode_failed", Message: "Failed to apply output profile", Err: err}
+			logger.Error("Failed to apply output profile", zap.Error(err), zap.String("profile", req.Profile))
+			apierror.AbortWithDetails(c, http.StatusInternalServerError, "transcode_failed", "Failed to apply output profile", gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+		download.FilePath = outputPath
+		c.Header("X-Output-Profile", req.Profile)
+	}
+	filePath, videoInfo := download.FilePath, download.Info
+	c.Header(attemptsHeader, strconv.Itoa(download.Attempts))
+
+	if download.Format != nil {
+		c.Header("X-Format-Selector", download.Format.Format)
+		if download.Format.Sort != "" {
+			c.Header("X-Format-Sort", download.Format.Sort)
+		}
+	}
+
+	if req.IncludeSubtitles && len(download.Subtitles) > 0 {
+		h.streamArchive(c, download)
+		job.Size = int64(c.Writer.Size())
+		return
+	}
+
 	reader, fileSize, err := h.ytdlpService.GetVideoReader(filePath)
 	if err != nil {
-		h.logger.Error("Failed to open video file for reading", zap.Error(err), zap.String("file", filePath))
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error":   "file_read_error",
-			"message": "Failed to read downloaded file",
-		})
+		jobErr = &pipeline.Error{Code: "file_read_error", Message: "Failed to read downloaded file", Err: err}
+		logger.Error("Failed to open video file for reading", zap.Error(err), zap.String("file", filePath))
+		apierror.Abort(c, http.StatusInternalServerError, "file_read_error", "Failed to read downloaded file")
 		return
 	}
 	defer reader.Close()
@@ -94,12 +219,77 @@ func (h *DownloadHandler) Handle(c *gin.Context) {
 	c.Header("Pragma", "no-cache")
 	c.Header("Expires", "0")
 
-	h.logger.Info("Streaming video file", 
+	logger.Info("Streaming video file", 
 		zap.String("filename", filename),
 		zap.Int64("size", fileSize),
 		zap.String("client_ip", c.ClientIP()))
 
 	c.DataFromReader(http.StatusOK, fileSize, contentType, reader, nil)
+	job.Size = fileSize
+}
+
+// redacted returns req as JSON with secrets masked, for the job store.
+func (req *DownloadRequest) redacted() json.RawMessage {
+	redacted := *req
+	redacted.Options = req.Options.Redacted()
+	data, _ := json.Marshal(&redacted)
+	return data
+}
+
+// streamArchive sends the media file and its subtitles as a single zip.
+func (h *DownloadHandler) streamArchive(c *gin.Context, download *ytdlp.DownloadResult) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	mediaName := h.generateDownloadFilename(download.FilePath, download.Info)
+	baseName := strings.TrimSuffix(mediaName, filepath.Ext(mediaName))
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s.zip\"", baseName))
+	c.Header("Cache-Control", "no-cache, no-store, must-revalidate")
+	c.Header("Pragma", "no-cache")
+	c.Header("Expires", "0")
+	c.Status(http.StatusOK)
+
+	logger.Info("Streaming video archive", 
+		zap.String("filename", baseName+".zip"),
+		zap.Int("subtitles", len(download.Subtitles)),
+		zap.String("client_ip", c.ClientIP()))
+
+	archive := zip.NewWriter(c.Writer)
+	// Media is already compressed, so store it as is and only deflate subtitles.
+	if err := h.addToArchive(archive, download.FilePath, mediaName, zip.Store); err != nil {
+		logger.Error("Failed to write media to archive", zap.Error(err))
+		return
+	}
+	for _, subtitle := range download.Subtitles {
+		name := fmt.Sprintf("%s.%s%s", baseName, subtitle.Language, filepath.Ext(subtitle.Path))
+		if err := h.addToArchive(archive, subtitle.Path, name, zip.Deflate); err != nil {
+			logger.Error("Failed to write subtitles to archive", zap.Error(err))
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		logger.Error("Failed to finish archive", zap.Error(err))
+	}
+}
+
+func (h *DownloadHandler) addToArchive(archive *zip.Writer, path, name string, method uint16) error {
+	reader, _, err := h.ytdlpService.GetVideoReader(path)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	writer, err := archive.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   method,
+		Modified: time.Now(),
+	})
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(writer, reader)
+	return err
 }
 
 func (h *DownloadHandler) generateDownloadFilename(filePath string, videoInfo *ytdlp.VideoInfo) string {
@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/callmemars1/ytdlp-http/internal/credentials"
+	"github.com/callmemars1/ytdlp-http/internal/pipeline"
+	"github.com/callmemars1/ytdlp-http/internal/server/apierror"
+	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// attemptsHeader reports how many yt-dlp runs a download took.
+	attemptsHeader = "X-Download-Attempts"
+	// jobIDHeader identifies the download in the job store.
+	jobIDHeader = "X-Job-ID"
+)
+
+var ytdlpErrorStatus = map[ytdlp.ErrorCode]int{
+	ytdlp.CodeUnsupportedURL:    http.StatusBadRequest,
+	ytdlp.CodeVideoUnavailable:  http.StatusNotFound,
+	ytdlp.CodePrivateVideo:      http.StatusForbidden,
+	ytdlp.CodeGeoBlocked:        http.StatusUnavailableForLegalReasons,
+	ytdlp.CodeAgeRestricted:     http.StatusForbidden,
+	ytdlp.CodeLoginRequired:     http.StatusForbidden,
+	ytdlp.CodeRateLimited:       http.StatusTooManyRequests,
+	ytdlp.CodeFileTooLarge:      http.StatusRequestEntityTooLarge,
+	ytdlp.CodeFormatUnavailable: http.StatusUnprocessableEntity,
+	ytdlp.CodeNetworkError:      http.StatusBadGateway,
+	ytdlp.CodeTimeout:           http.StatusGatewayTimeout,
+	ytdlp.CodeDownloadFailed:    http.StatusInternalServerError,
+}
+
+// abortUploadError responds with the status and error code for an error from
+// pipeline.Service.
+func abortUploadError(c *gin.Context, err error) {
+	var pipelineErr *pipeline.Error
+	switch {
+	case errors.Is(err, pipeline.ErrInvalidRequest):
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", err.Error())
+	case errors.Is(err, credentials.ErrUnknownProfile), errors.Is(err, credentials.ErrSiteNotAllowed), errors.Is(err, credentials.ErrScopeDenied):
+		abortCredentialsError(c, err)
+	case errors.As(err, &pipelineErr):
+		apierror.AbortWithDetails(c, http.StatusInternalServerError, pipelineErr.Code, pipelineErr.Message, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		abortDownloadError(c, err)
+	}
+}
+
+// abortDownloadError responds with the status and stable error code for an
+// error from ytdlp.Service. The raw yt-dlp output and the number of attempts
+// are attached as details.
+func abortDownloadError(c *gin.Context, err error) {
+	var ytdlpErr *ytdlp.Error
+	switch {
+	case errors.Is(err, ytdlp.ErrInvalidOptions):
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", err.Error())
+	case errors.Is(err, ytdlp.ErrShuttingDown):
+		apierror.Abort(c, http.StatusServiceUnavailable, "shutting_down", "Server is shutting down, retry on another instance")
+	case errors.As(err, &ytdlpErr):
+		c.Header(attemptsHeader, strconv.Itoa(ytdlpErr.Attempts))
+		apierror.AbortWithDetails(c, ytdlpErrorStatus[ytdlpErr.Code], string(ytdlpErr.Code), ytdlpErr.Message, gin.H{
+			"yt_dlp_output": ytdlpErr.Output,
+			"attempts":      ytdlpErr.Attempts,
+		})
+	case errors.Is(err, context.DeadlineExceeded):
+		apierror.Abort(c, http.StatusGatewayTimeout, string(ytdlp.CodeTimeout), "Timed out waiting for a download slot")
+	default:
+		apierror.AbortWithDetails(c, http.StatusInternalServerError, string(ytdlp.CodeDownloadFailed), "Failed to download video", gin.H{
+			"error": err.Error(),
+		})
+	}
+}
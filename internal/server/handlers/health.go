@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/callmemars1/ytdlp-http/internal/health"
+	"github.com/gin-gonic/gin"
+)
+
+// HealthHandler serves the liveness and readiness probes. Both bypass API key
+// authentication so orchestrators can reach them.
+type HealthHandler struct {
+	checker *health.Checker
+}
+
+func NewHealthHandler(checker *health.Checker) *HealthHandler {
+	return &HealthHandler{
+		checker: checker,
+	}
+}
+
+func (h *HealthHandler) SetupRoute(router gin.IRouter) {}
+
+func (h *HealthHandler) SetupPublicRoute(router gin.IRouter) {
+	router.GET("/healthz", h.Handle)
+	router.GET("/readyz", h.HandleReady)
+}
+
+func (h *HealthHandler) Handle(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"status": health.StatusOK,
+	})
+}
+
+func (h *HealthHandler) HandleReady(c *gin.Context) {
+	report := h.checker.Ready(c.Request.Context())
+
+	status := http.StatusOK
+	if !report.Ready {
+		status = http.StatusServiceUnavailable
+	}
+	c.JSON(status, report)
+}
@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/jobs"
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/s3"
+	"github.com/callmemars1/ytdlp-http/internal/server/apierror"
+	"github.com/callmemars1/ytdlp-http/internal/server/middlewares"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+const dateLayout = "2006-01-02"
+
+type HistoryHandler struct {
+	jobStore  *jobs.Store
+	s3Service *s3.Service
+	config    *configurations.S3Config
+	logger    *zap.Logger
+}
+
+type HistoryQuery struct {
+	Kind     string `form:"kind"`
+	Status   string `form:"status"`
+	Key      string `form:"key"`
+	URL      string `form:"url"`
+	VideoID  string `form:"video_id"`
+	Uploader string `form:"uploader"`
+	From     string `form:"from"`
+	To       string `form:"to"`
+	Q        string `form:"q"`
+	Sort     string `form:"sort"`
+	Order    string `form:"order"`
+	Limit    int    `form:"limit"`
+	Offset   int    `form:"offset"`
+}
+
+type HistoryResponse struct {
+	Jobs   []*HistoryEntry `json:"jobs"`
+	Total  int             `json:"total"`
+	Limit  int             `json:"limit"`
+	Offset int             `json:"offset"`
+}
+
+type HistoryEntry struct {
+	*jobs.Job
+	Objects []*HistoryObject `json:"objects,omitempty"`
+}
+
+type HistoryObject struct {
+	Key       string    `json:"key"`
+	URL       string    `json:"url,omitempty"`
+	ExpiresAt time.Time `json:"expires_at,omitzero"`
+}
+
+func NewHistoryHandler(jobStore *jobs.Store, s3Service *s3.Service, config *configurations.Config, logger *zap.Logger) *HistoryHandler {
+	return &HistoryHandler{
+		jobStore:  jobStore,
+		s3Service: s3Service,
+		config:    &config.S3,
+		logger:    logger,
+	}
+}
+
+func (h *HistoryHandler) SetupRoute(router gin.IRouter) {
+	router.GET("/history", h.Handle)
+}
+
+func (h *HistoryHandler) Handle(c *gin.Context) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	var query HistoryQuery
+	if err := c.ShouldBindQuery(&query); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", "Invalid query: "+err.Error())
+		return
+	}
+
+	filter, err := query.filter()
+	if err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", err.Error())
+		return
+	}
+	// Keys only see their own jobs, unless they are admins.
+	if !middlewares.IsAdmin(c) {
+		if query.Key != "" && query.Key != middlewares.KeyName(c) {
+			apierror.Abort(c, http.StatusForbidden, "forbidden", "Only admin keys may list jobs of other keys")
+			return
+		}
+		filter.Requester = middlewares.KeyName(c)
+	}
+
+	list, total, err := h.jobStore.List(c.Request.Context(), filter)
+	if err != nil {
+		if errors.Is(err, jobs.ErrInvalidFilter) {
+			apierror.Abort(c, http.StatusBadRequest, "bad_request", err.Error())
+			return
+		}
+		logger.Error("Failed to list jobs", zap.Error(err))
+		apierror.Abort(c, http.StatusInternalServerError, "internal_error", "Failed to list history")
+		return
+	}
+
+	expiresAt := time.Now().UTC().Add(h.config.PresignTTL)
+	entries := make([]*HistoryEntry, 0, len(list))
+	for _, job := range list {
+		entry := &HistoryEntry{Job: job}
+		for _, key := range job.S3Keys {
+			object := &HistoryObject{Key: key}
+			url, err := h.s3Service.PresignGet(c.Request.Context(), key, h.config.PresignTTL)
+			if err != nil {
+				logger.Warn("Failed to presign history object", zap.String("key", key), zap.Error(err))
+			} else {
+				object.URL = url
+				object.ExpiresAt = expiresAt
+			}
+			entry.Objects = append(entry.Objects, object)
+		}
+		entries = append(entries, entry)
+	}
+
+	c.JSON(http.StatusOK, HistoryResponse{
+		Jobs:   entries,
+		Total:  total,
+		Limit:  min(filter.Limit, jobs.MaxListLimit),
+		Offset: filter.Offset,
+	})
+}
+
+// filter validates the query. Dates are RFC 3339 timestamps or plain days;
+// a plain "to" day is included in the range.
+func (q *HistoryQuery) filter() (jobs.Filter, error) {
+	filter := jobs.Filter{
+		Kind:      jobs.KindUpload,
+		Status:    jobs.Status(q.Status),
+		Requester: q.Key,
+		URL:       q.URL,
+		VideoID:   q.VideoID,
+		Uploader:  q.Uploader,
+		Query:     strings.TrimSpace(q.Q),
+		Sort:      q.Sort,
+		Limit:     q.Limit,
+		Offset:    q.Offset,
+	}
+	if filter.Limit == 0 {
+		filter.Limit = jobs.DefaultListLimit
+	}
+	if filter.Limit < 0 || filter.Offset < 0 {
+		return filter, fmt.Errorf("limit and offset must not be negative")
+	}
+
+	switch jobs.Kind(q.Kind) {
+	case "", jobs.KindUpload:
+	case jobs.KindDownload:
+		filter.Kind = jobs.KindDownload
+	default:
+		return filter, fmt.Errorf("kind must be upload or download")
+	}
+
+	switch filter.Status {
+	case "", jobs.StatusQueued, jobs.StatusRunning, jobs.StatusSucceeded, jobs.StatusFailed, jobs.StatusInterrupted, jobs.StatusSkipped:
+	default:
+		return filter, fmt.Errorf("unknown status %q", q.Status)
+	}
+
+	switch strings.ToLower(q.Order) {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		return filter, fmt.Errorf("order must be asc or desc")
+	}
+
+	var err error
+	if filter.From, err = parseHistoryTime(q.From, false); err != nil {
+		return filter, fmt.Errorf("invalid from: %w", err)
+	}
+	if filter.To, err = parseHistoryTime(q.To, true); err != nil {
+		return filter, fmt.Errorf("invalid to: %w", err)
+	}
+	return filter, nil
+}
+
+func parseHistoryTime(value string, end bool) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if day, err := time.Parse(dateLayout, value); err == nil {
+		if end {
+			day = day.AddDate(0, 0, 1)
+		}
+		return day, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("use YYYY-MM-DD or RFC 3339")
+	}
+	return t, nil
+}
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/credentials"
+	"github.com/callmemars1/ytdlp-http/internal/links"
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/server/apierror"
+	"github.com/callmemars1/ytdlp-http/internal/server/middlewares"
+	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type LinkHandler struct {
+	linkService     *links.Service
+	credentialStore *credentials.Store
+	config          *configurations.LinksConfig
+	logger          *zap.Logger
+}
+
+type LinkRequest struct {
+	URL              string         `json:"url" binding:"required"`
+	Options          *ytdlp.Options `json:"options,omitempty"`
+	Profile          string         `json:"profile,omitempty"`
+	Timeout          int            `json:"timeout,omitempty"`
+	IncludeSubtitles bool           `json:"include_subtitles,omitempty"`
+	TTL              int            `json:"ttl,omitempty"`
+	BindIP           string         `json:"bind_ip,omitempty"`
+}
+
+type LinkResponse struct {
+	ID        string    `json:"id"`
+	URL       string    `json:"url"`
+	Token     string    `json:"token"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func NewLinkHandler(linkService *links.Service, credentialStore *credentials.Store, config *configurations.Config, logger *zap.Logger) *LinkHandler {
+	return &LinkHandler{
+		linkService:     linkService,
+		credentialStore: credentialStore,
+		config:          &config.Links,
+		logger:          logger,
+	}
+}
+
+func (h *LinkHandler) SetupRoute(router gin.IRouter) {
+	router.POST("/links", h.Handle)
+	router.DELETE("/links/:id", h.HandleRevoke)
+}
+
+func (h *LinkHandler) Handle(c *gin.Context) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	var req LinkRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Warn("Invalid link request", zap.Error(err))
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", "Invalid request body: "+err.Error())
+		return
+	}
+
+	scopes := middlewares.Scopes(c)
+	if !resolveCredentials(c, h.credentialStore, req.URL, req.Options, scopes) {
+		return
+	}
+
+	claims := &links.Claims{
+		URL:              req.URL,
+		Options:          req.Options,
+		Profile:          req.Profile,
+		Timeout:          req.Timeout,
+		IncludeSubtitles: req.IncludeSubtitles,
+		IP:               req.BindIP,
+		Requester:        middlewares.KeyName(c),
+		Scopes:           scopes,
+	}
+
+	token, err := h.linkService.Sign(c.Request.Context(), claims, time.Duration(req.TTL)*time.Second)
+	if err != nil {
+		logger.Error("Failed to sign download link", zap.Error(err))
+		apierror.Abort(c, http.StatusInternalServerError, "link_failed", "Failed to create download link")
+		return
+	}
+
+	logger.Info("Download link created",
+		zap.String("link_id", claims.ID),
+		zap.String("url", req.URL),
+		zap.Bool("ip_bound", req.BindIP != ""),
+		zap.String("client_ip", c.ClientIP()))
+
+	c.JSON(http.StatusCreated, LinkResponse{
+		ID:        claims.ID,
+		URL:       fmt.Sprintf("%s/d/%s", h.baseURL(c), token),
+		Token:     token,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0).UTC(),
+	})
+}
+
+// HandleRevoke revokes a link. Links minted by other API keys are reported
+// as not found to keys without the admin scope.
+func (h *LinkHandler) HandleRevoke(c *gin.Context) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	id := c.Param("id")
+	claims, err := h.linkService.Get(c.Request.Context(), id)
+	if err == nil && !middlewares.CanAccess(c, claims.Requester) {
+		err = links.ErrNotFound
+	}
+	if err == nil {
+		err = h.linkService.Revoke(c.Request.Context(), id)
+	}
+	if errors.Is(err, links.ErrNotFound) {
+		apierror.Abort(c, http.StatusNotFound, "not_found", "Link not found")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to revoke download link", zap.Error(err), zap.String("link_id", id))
+		apierror.Abort(c, http.StatusInternalServerError, "internal_error", "Failed to revoke download link")
+		return
+	}
+	c.Status(http.StatusNoContent)
+}
+
+func (h *LinkHandler) baseURL(c *gin.Context) string {
+	if h.config.BaseURL != "" {
+		return strings.TrimSuffix(h.config.BaseURL, "/")
+	}
+
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if forwarded := c.GetHeader("X-Forwarded-Proto"); forwarded != "" {
+		scheme = forwarded
+	}
+	return fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/metrics"
+	"github.com/callmemars1/ytdlp-http/internal/server/apierror"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+// MetricsHandler exposes Prometheus metrics. It bypasses API key
+// authentication and is optionally guarded by its own bearer token.
+type MetricsHandler struct {
+	metrics *metrics.Metrics
+	config  *configurations.MetricsConfig
+	handler http.Handler
+	logger  *zap.Logger
+}
+
+func NewMetricsHandler(m *metrics.Metrics, config *configurations.Config, logger *zap.Logger) *MetricsHandler {
+	return &MetricsHandler{
+		metrics: m,
+		config:  &config.Metrics,
+		handler: m.Handler(),
+		logger:  logger,
+	}
+}
+
+func (h *MetricsHandler) SetupRoute(router gin.IRouter) {}
+
+func (h *MetricsHandler) SetupPublicRoute(router gin.IRouter) {
+	if !h.config.Enabled {
+		return
+	}
+	router.GET("/metrics", h.Handle)
+}
+
+func (h *MetricsHandler) Handle(c *gin.Context) {
+	if h.config.Token != "" {
+		token, _ := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.config.Token)) != 1 {
+			h.logger.Warn("Invalid metrics token", zap.String("ip", c.ClientIP()))
+			apierror.Abort(c, http.StatusUnauthorized, "unauthorized", "Invalid metrics token")
+			return
+		}
+	}
+
+	h.handler.ServeHTTP(c.Writer, c.Request)
+}
@@ -0,0 +1,28 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/callmemars1/ytdlp-http/internal/transcode"
+	"github.com/gin-gonic/gin"
+)
+
+type ProfilesHandler struct {
+	transcodeService *transcode.Service
+}
+
+func NewProfilesHandler(transcodeService *transcode.Service) *ProfilesHandler {
+	return &ProfilesHandler{
+		transcodeService: transcodeService,
+	}
+}
+
+func (h *ProfilesHandler) SetupRoute(router gin.IRouter) {
+	router.GET("/profiles", h.Handle)
+}
+
+func (h *ProfilesHandler) Handle(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"profiles": h.transcodeService.Profiles(),
+	})
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/jobs"
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/server/apierror"
+	"github.com/callmemars1/ytdlp-http/internal/server/middlewares"
+	"github.com/callmemars1/ytdlp-http/internal/subscriptions"
+	"github.com/gin-gonic/gin"
+	"go.uber.org/zap"
+)
+
+type SubscriptionHandler struct {
+	scheduler *subscriptions.Scheduler
+	jobStore  *jobs.Store
+	logger    *zap.Logger
+}
+
+// SubscriptionRequest creates a subscription, or updates one with PATCH,
+// where fields left out keep their value.
+type SubscriptionRequest struct {
+	Name        *string         `json:"name,omitempty"`
+	URL         *string         `json:"url,omitempty"`
+	S3Prefix    *string         `json:"s3_prefix,omitempty"`
+	Interval    *string         `json:"interval,omitempty"`
+	Defaults    json.RawMessage `json:"defaults,omitempty"`
+	MaxEntries  *int            `json:"max_entries,omitempty"`
+	Concurrency *int            `json:"concurrency,omitempty"`
+	Enabled     *bool           `json:"enabled,omitempty"`
+}
+
+type SubscriptionResponse struct {
+	*jobs.Subscription
+	Interval string `json:"interval"`
+	Running  bool   `json:"running"`
+}
+
+func NewSubscriptionHandler(scheduler *subscriptions.Scheduler, jobStore *jobs.Store, logger *zap.Logger) *SubscriptionHandler {
+	return &SubscriptionHandler{
+		scheduler: scheduler,
+		jobStore:  jobStore,
+		logger:    logger,
+	}
+}
+
+func (h *SubscriptionHandler) SetupRoute(router gin.IRouter) {
+	router.POST("/subscriptions", h.Handle)
+	router.GET("/subscriptions", h.HandleList)
+	router.GET("/subscriptions/:id", h.HandleGet)
+	router.PATCH("/subscriptions/:id", h.HandleUpdate)
+	router.DELETE("/subscriptions/:id", h.HandleDelete)
+	router.POST("/subscriptions/:id/run", h.HandleRun)
+}
+
+func (h *SubscriptionHandler) Handle(c *gin.Context) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	var req SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		logger.Warn("Invalid subscription request", zap.Error(err))
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", "Invalid request body: "+err.Error())
+		return
+	}
+	if req.URL == nil || req.S3Prefix == nil || req.Interval == nil {
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", "url, s3_prefix and interval are required")
+		return
+	}
+
+	sub := &jobs.Subscription{
+		MaxEntries: subscriptions.DefaultMaxEntries,
+		Enabled:    true,
+		Requester:  middlewares.KeyName(c),
+		Scopes:     middlewares.Scopes(c),
+	}
+	if !h.apply(c, sub, &req) {
+		return
+	}
+	if err := h.jobStore.CreateSubscription(c.Request.Context(), sub); err != nil {
+		logger.Error("Failed to create subscription", zap.Error(err))
+		apierror.Abort(c, http.StatusInternalServerError, "internal_error", "Failed to create subscription")
+		return
+	}
+
+	logger.Info("Subscription created", zap.String("subscription_id", sub.ID), zap.String("url", sub.URL))
+	c.Header("Location", "/subscriptions/"+sub.ID)
+	c.JSON(http.StatusCreated, h.response(sub))
+}
+
+func (h *SubscriptionHandler) HandleList(c *gin.Context) {
+	subs, err := h.jobStore.ListSubscriptions(c.Request.Context())
+	if err != nil {
+		logging.FromContext(c.Request.Context(), h.logger).Error("Failed to list subscriptions", zap.Error(err))
+		apierror.Abort(c, http.StatusInternalServerError, "internal_error", "Failed to list subscriptions")
+		return
+	}
+
+	responses := make([]*SubscriptionResponse, 0, len(subs))
+	for _, sub := range subs {
+		if middlewares.CanAccess(c, sub.Requester) {
+			responses = append(responses, h.response(sub))
+		}
+	}
+	c.JSON(http.StatusOK, gin.H{"subscriptions": responses})
+}
+
+func (h *SubscriptionHandler) HandleGet(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+	c.JSON(http.StatusOK, h.response(sub))
+}
+
+func (h *SubscriptionHandler) HandleUpdate(c *gin.Context) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+
+	var req SubscriptionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", "Invalid request body: "+err.Error())
+		return
+	}
+	if !h.apply(c, sub, &req) {
+		return
+	}
+	if err := h.jobStore.UpdateSubscription(c.Request.Context(), sub); err != nil {
+		if errors.Is(err, jobs.ErrNotFound) {
+			apierror.Abort(c, http.StatusNotFound, "not_found", "Subscription not found")
+			return
+		}
+		logger.Error("Failed to update subscription", zap.Error(err))
+		apierror.Abort(c, http.StatusInternalServerError, "internal_error", "Failed to update subscription")
+		return
+	}
+
+	logger.Info("Subscription updated", zap.String("subscription_id", sub.ID))
+	c.JSON(http.StatusOK, h.response(sub))
+}
+
+func (h *SubscriptionHandler) HandleDelete(c *gin.Context) {
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+
+	err := h.jobStore.DeleteSubscription(c.Request.Context(), sub.ID)
+	if errors.Is(err, jobs.ErrNotFound) {
+		apierror.Abort(c, http.StatusNotFound, "not_found", "Subscription not found")
+		return
+	}
+	if err != nil {
+		logger.Error("Failed to delete subscription", zap.Error(err))
+		apierror.Abort(c, http.StatusInternalServerError, "internal_error", "Failed to delete subscription")
+		return
+	}
+
+	logger.Info("Subscription deleted", zap.String("subscription_id", sub.ID))
+	c.Status(http.StatusNoContent)
+}
+
+// HandleRun syncs a subscription now instead of waiting for its schedule.
+func (h *SubscriptionHandler) HandleRun(c *gin.Context) {
+	sub, ok := h.load(c)
+	if !ok {
+		return
+	}
+
+	if err := h.scheduler.Trigger(sub); err != nil {
+		if errors.Is(err, subscriptions.ErrRunning) {
+			apierror.Abort(c, http.StatusConflict, "conflict", err.Error())
+			return
+		}
+		abortUploadError(c, err)
+		return
+	}
+	c.JSON(http.StatusAccepted, h.response(sub))
+}
+
+// apply copies the fields set in req onto sub and validates the result on
+// behalf of the API key that created the subscription, which it runs as.
+func (h *SubscriptionHandler) apply(c *gin.Context, sub *jobs.Subscription, req *SubscriptionRequest) bool {
+	if req.Name != nil {
+		sub.Name = *req.Name
+	}
+	if req.URL != nil {
+		sub.URL = *req.URL
+	}
+	if req.S3Prefix != nil {
+		sub.S3Prefix = *req.S3Prefix
+	}
+	if req.Interval != nil {
+		interval, err := time.ParseDuration(*req.Interval)
+		if err != nil {
+			apierror.Abort(c, http.StatusBadRequest, "bad_request", "interval must be a duration like 6h")
+			return false
+		}
+		sub.Interval = interval
+	}
+	if req.Defaults != nil {
+		sub.Defaults = req.Defaults
+	}
+	if req.MaxEntries != nil {
+		sub.MaxEntries = *req.MaxEntries
+	}
+	if req.Concurrency != nil {
+		sub.Concurrency = *req.Concurrency
+	}
+	if req.Enabled != nil {
+		sub.Enabled = *req.Enabled
+	}
+
+	if err := h.scheduler.Validate(c.Request.Context(), sub); err != nil {
+		abortUploadError(c, err)
+		return false
+	}
+	return true
+}
+
+// load fetches the subscription named in the path. Subscriptions of other
+// API keys are reported as not found to keys without the admin scope. It
+// responds with an error and returns false if that fails.
+func (h *SubscriptionHandler) load(c *gin.Context) (*jobs.Subscription, bool) {
+	sub, err := h.jobStore.GetSubscription(c.Request.Context(), c.Param("id"))
+	if err == nil && !middlewares.CanAccess(c, sub.Requester) {
+		err = jobs.ErrNotFound
+	}
+	if errors.Is(err, jobs.ErrNotFound) {
+		apierror.Abort(c, http.StatusNotFound, "not_found", "Subscription not found")
+		return nil, false
+	}
+	if err != nil {
+		logging.FromContext(c.Request.Context(), h.logger).Error("Failed to get subscription", zap.Error(err))
+		apierror.Abort(c, http.StatusInternalServerError, "internal_error", "Failed to get subscription")
+		return nil, false
+	}
+	return sub, true
+}
+
+func (h *SubscriptionHandler) response(sub *jobs.Subscription) *SubscriptionResponse {
+	return &SubscriptionResponse{
+		Subscription: sub,
+		Interval:     sub.Interval.String(),
+		Running:      h.scheduler.Running(sub.ID),
+	}
+}
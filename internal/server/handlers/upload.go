@@ -1,43 +1,39 @@
 package handlers
 
 import (
-	"context"
 	"net/http"
-	"path/filepath"
-	"time"
 
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/pipeline"
 	"github.com/callmemars1/ytdlp-http/internal/s3"
-	"github.com/callmemars1/ytdlp-http/internal/utils"
+	"github.com/callmemars1/ytdlp-http/internal/server/apierror"
+	"github.com/callmemars1/ytdlp-http/internal/server/middlewares"
 	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
 type UploadHandler struct {
-	ytdlpService *ytdlp.Service
-	s3Service    *s3.Service
-	logger       *zap.Logger
-}
-
-type UploadRequest struct {
-	URL     string         `json:"url" binding:"required"`
-	S3Key   string         `json:"s3_key" binding:"required"`
-	Options *ytdlp.Options `json:"options,omitempty"`
-	Timeout int            `json:"timeout,omitempty"`
+	pipelineService *pipeline.Service
+	logger          *zap.Logger
 }
 
 type UploadResponse struct {
-	Success bool                `json:"success"`
-	Message string              `json:"message,omitempty"`
-	Result  *s3.UploadResult    `json:"result,omitempty"`
-	Error   string              `json:"error,omitempty"`
+	Success bool                   `json:"success"`
+	Message string                 `json:"message,omitempty"`
+	JobID   string                 `json:"job_id,omitempty"`
+	Result  *s3.UploadResult       `json:"result,omitempty"`
+	Format  *ytdlp.FormatSelection `json:"format,omitempty"`
+	Skipped string                 `json:"skipped,omitempty"`
+
+	// DownloadAttempts is the number of yt-dlp runs the download took.
+	DownloadAttempts int `json:"download_attempts"`
 }
 
-func NewUploadHandler(ytdlpService *ytdlp.Service, s3Service *s3.Service, logger *zap.Logger) *UploadHandler {
+func NewUploadHandler(pipelineService *pipeline.Service, logger *zap.Logger) *UploadHandler {
 	return &UploadHandler{
-		ytdlpService: ytdlpService,
-		s3Service:    s3Service,
-		logger:       logger,
+		pipelineService: pipelineService,
+		logger:          logger,
 	}
 }
 
@@ -46,78 +42,45 @@ func (h *UploadHandler) SetupRoute(router gin.IRouter) {
 }
 
 func (h *UploadHandler) Handle(c *gin.Context) {
-	var req UploadRequest
+	logger := logging.FromContext(c.Request.Context(), h.logger)
+	var req pipeline.UploadRequest
 	if err := c.ShouldBindJSON(&req); err != nil {
-		h.logger.Warn("Invalid upload request", zap.Error(err))
-		c.JSON(http.StatusBadRequest, UploadResponse{
-			Success: false,
-			Error:   "Invalid request body: " + err.Error(),
-		})
+		logger.Warn("Invalid upload request", zap.Error(err))
+		apierror.Abort(c, http.StatusBadRequest, "bad_request", "Invalid request body: "+err.Error())
 		return
 	}
 
-	timeout := time.Duration(req.Timeout) * time.Second
-	if timeout == 0 {
-		timeout = 10 * time.Minute
-	}
-
-	ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
-	defer cancel()
-
-	h.logger.Info("Starting video download and S3 upload", 
+	logger.Info("Received upload request",
 		zap.String("url", req.URL),
-		zap.String("s3_key", req.S3Key),
 		zap.String("client_ip", c.ClientIP()))
 
-	filePath, videoInfo, err := h.ytdlpService.DownloadVideo(ctx, req.URL, req.Options)
+	result, err := h.pipelineService.Upload(c.Request.Context(), &req, pipeline.Requester{
+		Name:   middlewares.KeyName(c),
+		Scopes: middlewares.Scopes(c),
+	})
 	if err != nil {
-		h.logger.Error("Failed to download video", zap.Error(err), zap.String("url", req.URL))
-		c.JSON(http.StatusInternalServerError, UploadResponse{
-			Success: false,
-			Error:   "Failed to download video: " + err.Error(),
-		})
+		abortUploadError(c, err)
 		return
 	}
-	defer func() {
-		if cleanupErr := h.ytdlpService.CleanupFile(filePath); cleanupErr != nil {
-			h.logger.Error("Failed to cleanup file", zap.Error(cleanupErr), zap.String("file", filePath))
-		}
-	}()
-
-	uniqueKey := h.generateUniqueS3Key(req.S3Key, filePath)
-
-	uploadResult, err := h.s3Service.UploadVideoWithMetadata(ctx, filePath, uniqueKey, videoInfo)
-	if err != nil {
-		h.logger.Error("Failed to upload to S3", zap.Error(err), 
-			zap.String("file", filePath),
-			zap.String("s3_key", uniqueKey))
-		c.JSON(http.StatusInternalServerError, UploadResponse{
-			Success: false,
-			Error:   "Failed to upload to S3: " + err.Error(),
+	if result.Skipped != "" {
+		c.JSON(http.StatusOK, UploadResponse{
+			Success: true,
+			Message: "Video is already in the download archive, nothing was uploaded",
+			JobID:   result.JobID,
+			Skipped: result.Skipped,
+
+			DownloadAttempts: result.Attempts,
 		})
 		return
 	}
 
-	h.logger.Info("Video uploaded successfully to S3", 
-		zap.String("video_key", uploadResult.VideoUpload.Key),
-		zap.String("metadata_key", uploadResult.MetadataUpload.Key),
-		zap.Int64("total_size", uploadResult.TotalSize),
-		zap.String("client_ip", c.ClientIP()))
-
 	c.JSON(http.StatusOK, UploadResponse{
 		Success: true,
 		Message: "Video uploaded successfully to S3-compatible storage",
-		Result:  uploadResult,
+		JobID:   result.JobID,
+		Result:  result.Upload,
+		Format:  result.Format,
+
+		DownloadAttempts: result.Attempts,
 	})
 }
-
-func (h *UploadHandler) generateUniqueS3Key(requestedKey, filePath string) string {
-	ext := filepath.Ext(filePath)
-	
-	if filepath.Ext(requestedKey) == "" {
-		requestedKey = requestedKey + ext
-	}
-	
-	safeName := utils.SanitizeFilename(requestedKey)
-	return utils.GenerateUniqueKey(safeName)
-}
\ No newline at end of file
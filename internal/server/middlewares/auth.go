@@ -2,25 +2,95 @@ package middlewares
 
 import (
 	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"slices"
 	"strings"
 
 	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/server/apierror"
 	"github.com/gin-gonic/gin"
 	"go.uber.org/zap"
 )
 
+const apiKeyContextKey = "api_key"
+
+// AdminScope lets a key see and manage the jobs, batches and subscriptions
+// of other keys.
+const AdminScope = "admin"
+
+// APIKey is an accepted key, identified by the SHA256 hash of its value.
+// Scopes restrict which credential profiles the key may use.
+type APIKey struct {
+	Name   string   `json:"name"`
+	Hash   string   `json:"hash"`
+	Scopes []string `json:"scopes,omitempty"`
+}
+
 type AuthMiddleware struct {
 	config *configurations.AuthConfig
+	keys   []APIKey
 	logger *zap.Logger
 }
 
-func NewAuthMiddleware(config *configurations.AuthConfig, logger *zap.Logger) *AuthMiddleware {
+func NewAuthMiddleware(config *configurations.AuthConfig, logger *zap.Logger) (*AuthMiddleware, error) {
+	var keys []APIKey
+	if config.APIKey != "" {
+		keys = append(keys, APIKey{Name: "default", Hash: config.APIKey})
+	}
+	if config.KeysFile != "" {
+		data, err := os.ReadFile(config.KeysFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read API keys file: %w", err)
+		}
+		var fileKeys []APIKey
+		if err := json.Unmarshal(data, &fileKeys); err != nil {
+			return nil, fmt.Errorf("failed to parse API keys file: %w", err)
+		}
+		keys = append(keys, fileKeys...)
+	}
+
 	return &AuthMiddleware{
 		config: config,
+		keys:   keys,
 		logger: logger,
+	}, nil
+}
+
+// Scopes returns the scopes of the API key that authenticated the request.
+func Scopes(c *gin.Context) []string {
+	if key, ok := c.Get(apiKeyContextKey); ok {
+		return key.(*APIKey).Scopes
 	}
+	return nil
+}
+
+// KeyName returns the name of the API key that authenticated the request, or
+// "" if authentication is disabled.
+func KeyName(c *gin.Context) string {
+	if key, ok := c.Get(apiKeyContextKey); ok {
+		return key.(*APIKey).Name
+	}
+	return ""
+}
+
+// IsAdmin reports whether the request may act on records of other API keys.
+// Every request may when authentication is disabled.
+func IsAdmin(c *gin.Context) bool {
+	key, ok := c.Get(apiKeyContextKey)
+	if !ok {
+		return true
+	}
+	return slices.Contains(key.(*APIKey).Scopes, AdminScope)
+}
+
+// CanAccess reports whether the request may act on a record created by the
+// API key named requester.
+func CanAccess(c *gin.Context, requester string) bool {
+	return IsAdmin(c) || requester == KeyName(c)
 }
 
 func (a *AuthMiddleware) Authenticate() gin.HandlerFunc {
@@ -33,11 +103,7 @@ func (a *AuthMiddleware) Authenticate() gin.HandlerFunc {
 		authHeader := c.GetHeader("Authorization")
 		if authHeader == "" {
 			a.logger.Warn("Missing Authorization header", zap.String("ip", c.ClientIP()))
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "unauthorized",
-				"message": "Authorization header is required",
-			})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, "unauthorized", "Authorization header is required")
 			return
 		}
 
@@ -46,37 +112,36 @@ func (a *AuthMiddleware) Authenticate() gin.HandlerFunc {
 			a.logger.Warn("Invalid Authorization header format", 
 				zap.String("ip", c.ClientIP()), 
 				zap.String("header", authHeader))
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "unauthorized", 
-				"message": "Authorization header must be in format: Bearer <token>",
-			})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, "unauthorized", "Authorization header must be in format: Bearer <token>")
 			return
 		}
 
 		providedKey := parts[1]
-		if !a.validateAPIKey(providedKey) {
+		key := a.validateAPIKey(providedKey)
+		if key == nil {
 			a.logger.Warn("Invalid API key provided", 
 				zap.String("ip", c.ClientIP()),
 				zap.String("provided_key_hash", a.hashKey(providedKey)))
-			c.JSON(http.StatusUnauthorized, gin.H{
-				"error":   "unauthorized",
-				"message": "Invalid API key",
-			})
-			c.Abort()
+			apierror.Abort(c, http.StatusUnauthorized, "unauthorized", "Invalid API key")
 			return
 		}
 
-		a.logger.Debug("API key validated successfully", zap.String("ip", c.ClientIP()))
+		a.logger.Debug("API key validated successfully", 
+			zap.String("ip", c.ClientIP()),
+			zap.String("key_name", key.Name))
+		c.Set(apiKeyContextKey, key)
 		c.Next()
 	}
 }
 
-func (a *AuthMiddleware) validateAPIKey(providedKey string) bool {
+func (a *AuthMiddleware) validateAPIKey(providedKey string) *APIKey {
 	providedHash := a.hashKey(providedKey)
-	expectedHash := a.config.APIKey
-	
-	return providedHash == expectedHash
+	for i := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(providedHash), []byte(strings.ToLower(a.keys[i].Hash))) == 1 {
+			return &a.keys[i]
+		}
+	}
+	return nil
 }
 
 func (a *AuthMiddleware) hashKey(key string) string {
@@ -0,0 +1,35 @@
+package middlewares
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/metrics"
+	"github.com/gin-gonic/gin"
+)
+
+type MetricsMiddleware struct {
+	metrics *metrics.Metrics
+}
+
+func NewMetricsMiddleware(m *metrics.Metrics) *MetricsMiddleware {
+	return &MetricsMiddleware{
+		metrics: m,
+	}
+}
+
+func (m *MetricsMiddleware) Instrument() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		status := strconv.Itoa(c.Writer.Status())
+
+		m.metrics.HTTPRequests.WithLabelValues(route, c.Request.Method, status).Inc()
+		m.metrics.HTTPRequestDuration.WithLabelValues(route, c.Request.Method, status).Observe(time.Since(start).Seconds())
+	}
+}
@@ -0,0 +1,29 @@
+package middlewares
+
+import (
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/requestid"
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// RequestID accepts the client's X-Request-ID or generates one, stores it in
+// the request context along with a logger tagged with it, records it on the
+// server span and echoes it in the response.
+func RequestID(logger *zap.Logger) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader(requestid.Header)
+		if !requestid.Valid(id) {
+			id = requestid.New()
+		}
+
+		ctx := requestid.NewContext(c.Request.Context(), id)
+		ctx = logging.NewContext(ctx, logger.With(zap.String("request_id", id)))
+		trace.SpanFromContext(ctx).SetAttributes(attribute.String("request.id", id))
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(requestid.Header, id)
+		c.Next()
+	}
+}
@@ -2,37 +2,89 @@ package server
 
 import (
 	"context"
+	"errors"
+	"net"
 	"net/http"
 	"time"
 
 	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/health"
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/requestid"
+	"github.com/callmemars1/ytdlp-http/internal/server/apierror"
 	"github.com/callmemars1/ytdlp-http/internal/server/middlewares"
+	"github.com/callmemars1/ytdlp-http/internal/tracing"
 	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/contrib/instrumentation/github.com/gin-gonic/gin/otelgin"
 	"go.uber.org/fx"
 	"go.uber.org/zap"
 )
 
+// infrastructurePaths are polled by infrastructure. They are not traced, as
+// they would drown out real traces, and stay reachable while draining.
+var infrastructurePaths = map[string]bool{
+	"/metrics": true,
+	"/healthz": true,
+	"/readyz":  true,
+}
+
 func RunHTTPServer(
 	lc fx.Lifecycle,
 	config *configurations.Config,
 	authMiddleware *middlewares.AuthMiddleware,
+	metricsMiddleware *middlewares.MetricsMiddleware,
+	healthChecker *health.Checker,
 	handlers []Handler,
+	tracerProvider *tracing.Provider,
 	logger *zap.Logger,
 ) *http.Server {
 	gin.SetMode(gin.ReleaseMode)
 	router := gin.New()
+	router.HandleMethodNotAllowed = true
 	
-	router.Use(gin.Recovery())
+	// Tracing goes first so that the server span covers every other middleware.
+	router.Use(otelgin.Middleware(config.Tracing.ServiceName,
+		otelgin.WithTracerProvider(tracerProvider),
+		otelgin.WithFilter(func(r *http.Request) bool {
+			return !infrastructurePaths[r.URL.Path]
+		}),
+	))
+	router.Use(middlewares.RequestID(logger))
+	router.Use(apierror.Debug(config.Server.Debug))
+	router.Use(gin.CustomRecovery(func(c *gin.Context, recovered any) {
+		logging.FromContext(c.Request.Context(), logger).Error("Recovered from panic", 
+			zap.Any("panic", recovered),
+			zap.String("path", c.Request.URL.Path))
+		apierror.Abort(c, http.StatusInternalServerError, "internal_error", "Internal server error")
+	}))
 	router.Use(ginLogger(logger))
-	router.Use(authMiddleware.Authenticate())
+	router.Use(metricsMiddleware.Instrument())
+
+	router.NoRoute(func(c *gin.Context) {
+		apierror.Abort(c, http.StatusNotFound, "not_found", "Route not found")
+	})
+	router.NoMethod(func(c *gin.Context) {
+		apierror.Abort(c, http.StatusMethodNotAllowed, "method_not_allowed", "Method not allowed")
+	})
+
+	public := router.Group("", refuseWhileDraining(healthChecker))
+	protected := router.Group("", authMiddleware.Authenticate(), refuseWhileDraining(healthChecker))
 
 	for _, handler := range handlers {
-		handler.SetupRoute(router)
+		handler.SetupRoute(protected)
+		if publicHandler, ok := handler.(PublicHandler); ok {
+			publicHandler.SetupPublicRoute(public)
+		}
 	}
 
+	// Request contexts derive from baseCtx so that in-flight yt-dlp processes
+	// are cancelled if they outlive the drain period.
+	baseCtx, cancelRequests := context.WithCancel(context.Background())
+
 	srv := &http.Server{
-		Addr:    config.Server.Addr,
-		Handler: router,
+		Addr:        config.Server.Addr,
+		Handler:     router,
+		BaseContext: func(net.Listener) context.Context { return baseCtx },
 	}
 	lc.Append(fx.Hook{
 		OnStart: func(ctx context.Context) error {
@@ -45,18 +97,50 @@ func RunHTTPServer(
 			return nil
 		},
 		OnStop: func(ctx context.Context) error {
-			logger.Info("Shutting down HTTP server")
-			shutdownCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+			defer cancelRequests()
+
+			logger.Info("Shutting down HTTP server",
+				zap.Duration("delay", config.Server.ShutdownDelay),
+				zap.Duration("drain_timeout", config.Server.ShutdownTimeout))
+			healthChecker.SetDraining()
+
+			// Give load balancers time to observe the failing readiness probe.
+			select {
+			case <-time.After(config.Server.ShutdownDelay):
+			case <-ctx.Done():
+			}
+
+			shutdownCtx, cancel := context.WithTimeout(ctx, config.Server.ShutdownTimeout)
 			defer cancel()
-			return srv.Shutdown(shutdownCtx)
+
+			err := srv.Shutdown(shutdownCtx)
+			if errors.Is(err, context.DeadlineExceeded) {
+				logger.Warn("Drain period elapsed, aborting in-flight requests")
+				cancelRequests()
+				return srv.Close()
+			}
+			return err
 		},
 	})
 	return srv
 }
 
+// refuseWhileDraining rejects new work once graceful shutdown has started.
+func refuseWhileDraining(healthChecker *health.Checker) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if healthChecker.Draining() && !infrastructurePaths[c.FullPath()] {
+			c.Header("Retry-After", "30")
+			apierror.Abort(c, http.StatusServiceUnavailable, "shutting_down", "Server is shutting down, retry on another instance")
+			return
+		}
+		c.Next()
+	}
+}
+
 func ginLogger(logger *zap.Logger) gin.HandlerFunc {
 	return gin.LoggerWithFormatter(func(param gin.LogFormatterParams) string {
 		logger.Info("HTTP request",
+			zap.String("request_id", requestid.FromContext(param.Request.Context())),
 			zap.String("method", param.Method),
 			zap.String("path", param.Path),
 			zap.Int("status", param.StatusCode),
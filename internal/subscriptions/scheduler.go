@@ -0,0 +1,298 @@
+package subscriptions
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/jobs"
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/pipeline"
+	"github.com/callmemars1/ytdlp-http/internal/ytdlp"
+	"go.uber.org/zap"
+)
+
+// ErrRunning is returned when a run is requested for a subscription that is
+// already being synced.
+var ErrRunning = errors.New("subscription is already running")
+
+const DefaultMaxEntries = 50
+
+// Scheduler periodically lists subscribed channels and playlists and queues
+// uploads for entries it has not seen yet.
+type Scheduler struct {
+	config          *configurations.SubscriptionsConfig
+	jobStore        *jobs.Store
+	ytdlpService    *ytdlp.Service
+	pipelineService *pipeline.Service
+	logger          *zap.Logger
+
+	mu      sync.Mutex
+	running map[string]bool
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func NewScheduler(cfg *configurations.SubscriptionsConfig, jobStore *jobs.Store, ytdlpService *ytdlp.Service, pipelineService *pipeline.Service, logger *zap.Logger) *Scheduler {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Scheduler{
+		config:          cfg,
+		jobStore:        jobStore,
+		ytdlpService:    ytdlpService,
+		pipelineService: pipelineService,
+		logger:          logger,
+		running:         make(map[string]bool),
+		ctx:             ctx,
+		cancel:          cancel,
+	}
+}
+
+// Start polls for due subscriptions until Shutdown. Runs can still be
+// triggered by hand when scheduling is disabled.
+func (s *Scheduler) Start() {
+	if !s.config.Enabled {
+		s.logger.Info("Subscription scheduling is disabled")
+		return
+	}
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(s.config.PollInterval)
+		defer ticker.Stop()
+		for {
+			s.runDue()
+			select {
+			case <-ticker.C:
+			case <-s.ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+// Shutdown stops scheduling and cancels runs still listing. Uploads they
+// queued are left to the pipeline service.
+func (s *Scheduler) Shutdown(ctx context.Context) error {
+	s.cancel()
+
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Validate checks sub's settings, and that its defaults make valid uploads
+// for the subscription's requester.
+func (s *Scheduler) Validate(ctx context.Context, sub *jobs.Subscription) error {
+	if sub.URL == "" || strings.Trim(sub.S3Prefix, "/") == "" {
+		return fmt.Errorf("%w: url and s3_prefix are required", pipeline.ErrInvalidRequest)
+	}
+	if sub.Interval < s.config.MinInterval {
+		return fmt.Errorf("%w: interval must be at least %s", pipeline.ErrInvalidRequest, s.config.MinInterval)
+	}
+	if sub.MaxEntries < 1 || sub.MaxEntries > s.config.MaxEntries {
+		return fmt.Errorf("%w: max_entries must be between 1 and %d", pipeline.ErrInvalidRequest, s.config.MaxEntries)
+	}
+
+	item, _ := json.Marshal(map[string]string{"url": sub.URL, "s3_key": path.Join(sub.S3Prefix, "validate")})
+	err := s.pipelineService.ValidateBatch(ctx, &pipeline.BatchRequest{
+		Items:       []json.RawMessage{item},
+		Defaults:    sub.Defaults,
+		Concurrency: sub.Concurrency,
+	}, requester(sub))
+	// The sample item is built here, so any problem lies in the defaults.
+	var itemErr *pipeline.ItemError
+	if errors.As(err, &itemErr) {
+		return fmt.Errorf("defaults: %w", itemErr.Err)
+	}
+	return err
+}
+
+// Trigger syncs sub now, in the background.
+func (s *Scheduler) Trigger(sub *jobs.Subscription) error {
+	if s.ctx.Err() != nil {
+		return ytdlp.ErrShuttingDown
+	}
+	if !s.start(sub) {
+		return ErrRunning
+	}
+	return nil
+}
+
+// Running reports whether sub is being synced.
+func (s *Scheduler) Running(id string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.running[id]
+}
+
+func (s *Scheduler) runDue() {
+	due, err := s.jobStore.DueSubscriptions(s.ctx, time.Now())
+	if err != nil {
+		if s.ctx.Err() == nil {
+			s.logger.Error("Failed to list due subscriptions", zap.Error(err))
+		}
+		return
+	}
+	for _, sub := range due {
+		s.start(sub)
+	}
+}
+
+// start syncs sub in the background unless it is already running.
+func (s *Scheduler) start(sub *jobs.Subscription) bool {
+	s.mu.Lock()
+	if s.running[sub.ID] {
+		s.mu.Unlock()
+		return false
+	}
+	s.running[sub.ID] = true
+	s.mu.Unlock()
+
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		defer func() {
+			s.mu.Lock()
+			delete(s.running, sub.ID)
+			s.mu.Unlock()
+		}()
+		s.sync(sub)
+	}()
+	return true
+}
+
+func (s *Scheduler) sync(sub *jobs.Subscription) {
+	logger := s.logger.With(zap.String("subscription_id", sub.ID))
+	ctx := logging.NewContext(s.ctx, logger)
+
+	run := &jobs.SubscriptionRun{At: time.Now().UTC(), Status: jobs.RunSucceeded}
+	if err := s.queueNew(ctx, sub, run); err != nil {
+		if s.ctx.Err() != nil {
+			// Interrupted by shutdown; the run stays due and is retried on
+			// the next start.
+			logger.Info("Subscription run cancelled")
+			return
+		}
+		logger.Error("Subscription run failed", zap.Error(err), zap.String("url", sub.URL))
+		run.Status = jobs.RunFailed
+		run.Error = err.Error()
+	}
+
+	if err := s.jobStore.RecordSubscriptionRun(context.WithoutCancel(ctx), sub, run); err != nil {
+		logger.Error("Failed to record subscription run", zap.Error(err))
+	}
+	logger.Info("Subscription run finished",
+		zap.String("status", run.Status),
+		zap.Int("listed", run.Listed),
+		zap.Int("queued", run.Queued),
+		zap.Time("next_run_at", sub.NextRunAt))
+}
+
+// queueNew lists sub and submits a batch for entries that have not been
+// uploaded yet, oldest first.
+func (s *Scheduler) queueNew(ctx context.Context, sub *jobs.Subscription, run *jobs.SubscriptionRun) error {
+	// Listing needs the same credentials and proxy as the uploads.
+	options, err := s.pipelineService.DefaultOptions(sub.Defaults, sub.URL, requester(sub))
+	if err != nil {
+		return err
+	}
+	playlist, err := s.ytdlpService.ListPlaylist(ctx, sub.URL, sub.MaxEntries, options)
+	if err != nil {
+		return err
+	}
+	run.Listed = len(playlist.Entries)
+
+	seen, err := s.jobStore.SubscriptionEntries(ctx, sub.ID)
+	if err != nil {
+		return err
+	}
+
+	// Subscriptions skip videos already uploaded to the same destination,
+	// by this or any other subscription, unless the defaults say otherwise.
+	var defaults map[string]any
+	if len(sub.Defaults) > 0 {
+		if err := json.Unmarshal(sub.Defaults, &defaults); err != nil {
+			return fmt.Errorf("invalid subscription defaults: %w", err)
+		}
+	}
+	_, archiveSet := defaults["archive"]
+
+	var (
+		items   []json.RawMessage
+		pending []*jobs.SubscriptionEntry
+	)
+	for i := len(playlist.Entries) - 1; i >= 0; i-- {
+		entry := playlist.Entries[i]
+		// Nested playlists, like the tabs of a channel, are not followed.
+		if entry.ID == "" || entry.URL == "" || entry.IsPlaylist() {
+			continue
+		}
+		if previous, ok := seen[entry.ID]; ok && !s.retry(previous) {
+			continue
+		}
+
+		fields := map[string]any{"url": entry.URL, "s3_key": path.Join(sub.S3Prefix, entry.ID)}
+		if !archiveSet {
+			fields["archive"] = true
+		}
+		item, _ := json.Marshal(fields)
+		items = append(items, item)
+		pending = append(pending, &jobs.SubscriptionEntry{VideoID: entry.ID, URL: entry.URL})
+	}
+	if len(items) == 0 {
+		return nil
+	}
+
+	batch, err := s.pipelineService.SubmitBatch(ctx, &pipeline.BatchRequest{
+		Items:          items,
+		Defaults:       sub.Defaults,
+		Concurrency:    sub.Concurrency,
+		SubscriptionID: sub.ID,
+	}, requester(sub))
+	if err != nil {
+		return err
+	}
+	run.BatchID = batch.ID
+	run.Queued = len(items)
+
+	batchJobs, err := s.jobStore.BatchJobs(context.WithoutCancel(ctx), batch.ID)
+	if err != nil {
+		return err
+	}
+	for i, job := range batchJobs {
+		pending[i].JobID = job.ID
+	}
+	return s.jobStore.SaveSubscriptionEntries(context.WithoutCancel(ctx), sub.ID, pending)
+}
+
+// retry reports whether an entry queued before should be queued again: its
+// job did not succeed and it has attempts left.
+func (s *Scheduler) retry(entry *jobs.SubscriptionEntry) bool {
+	switch entry.Status {
+	case jobs.StatusQueued, jobs.StatusRunning, jobs.StatusSucceeded, jobs.StatusSkipped:
+		return false
+	}
+	return entry.Attempts < s.config.MaxAttempts
+}
+
+func requester(sub *jobs.Subscription) pipeline.Requester {
+	return pipeline.Requester{Name: sub.Requester, Scopes: sub.Scopes}
+}
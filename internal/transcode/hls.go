@@ -0,0 +1,217 @@
+package transcode
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.uber.org/zap"
+)
+
+var ErrInvalidHLSOptions = errors.New("invalid HLS options")
+
+const (
+	defaultSegmentDuration = 6
+	maxRenditions          = 5
+	masterPlaylistName     = "master.m3u8"
+)
+
+type HLSOptions struct {
+	SegmentType     string `json:"segment_type,omitempty"`
+	SegmentDuration int    `json:"segment_duration,omitempty"`
+	Renditions      []int  `json:"renditions,omitempty"`
+}
+
+// HLSResult describes a packaged HLS tree rooted at Dir.
+type HLSResult struct {
+	Dir             string  `json:"-"`
+	MasterPlaylist  string  `json:"master_playlist"`
+	SegmentType     string  `json:"segment_type"`
+	SegmentDuration int     `json:"segment_duration"`
+	Renditions      []int   `json:"renditions,omitempty"`
+	Remuxed         bool    `json:"remuxed"`
+	Duration        float64 `json:"duration_seconds"`
+}
+
+func (o *HLSOptions) Validate() error {
+	if o == nil {
+		return nil
+	}
+	switch o.SegmentType {
+	case "", "fmp4", "ts":
+	default:
+		return fmt.Errorf("%w: segment_type must be fmp4 or ts", ErrInvalidHLSOptions)
+	}
+	if o.SegmentDuration < 0 || o.SegmentDuration > 30 {
+		return fmt.Errorf("%w: segment_duration must be between 1 and 30 seconds", ErrInvalidHLSOptions)
+	}
+	if len(o.Renditions) > maxRenditions {
+		return fmt.Errorf("%w: at most %d renditions", ErrInvalidHLSOptions, maxRenditions)
+	}
+	for _, height := range o.Renditions {
+		if height < 144 || height > 4320 {
+			return fmt.Errorf("%w: rendition height %d out of range", ErrInvalidHLSOptions, height)
+		}
+	}
+	return nil
+}
+
+// PackageHLS segments inputPath into an HLS tree with a master playlist in a
+// "hls" directory next to the input. Without renditions the source is
+// packaged as a single variant, copying H.264/AAC streams where possible.
+func (s *Service) PackageHLS(ctx context.Context, inputPath string, opts *HLSOptions) (*HLSResult, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	if opts == nil {
+		opts = &HLSOptions{}
+	}
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+
+	streams, err := probe(ctx, inputPath)
+	if err != nil {
+		return nil, err
+	}
+
+	video, audio := mediaStreams(streams)
+	if video == nil {
+		return nil, fmt.Errorf("%w: input has no video stream", ErrInvalidHLSOptions)
+	}
+
+	result := &HLSResult{
+		Dir:             filepath.Join(filepath.Dir(inputPath), "hls"),
+		MasterPlaylist:  masterPlaylistName,
+		SegmentType:     opts.SegmentType,
+		SegmentDuration: opts.SegmentDuration,
+		Renditions:      opts.Renditions,
+	}
+	if result.SegmentType == "" {
+		result.SegmentType = "fmp4"
+	}
+	if result.SegmentDuration == 0 {
+		result.SegmentDuration = defaultSegmentDuration
+	}
+
+	variants := len(opts.Renditions)
+	if variants == 0 {
+		variants = 1
+	}
+	if err := os.MkdirAll(result.Dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create HLS directory: %w", err)
+	}
+
+	hasAudio := audio != nil
+	args := []string{"-hide_banner", "-nostdin", "-y", "-i", inputPath}
+	if s.config.Threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(s.config.Threads))
+	}
+
+	if len(opts.Renditions) > 0 {
+		var filter strings.Builder
+		fmt.Fprintf(&filter, "[%s]split=%d", streamMap(video), variants)
+		for i := range opts.Renditions {
+			fmt.Fprintf(&filter, "[s%d]", i)
+		}
+		for i, height := range opts.Renditions {
+			fmt.Fprintf(&filter, ";[s%d]scale=-2:%d[v%d]", i, height, i)
+		}
+		args = append(args, "-filter_complex", filter.String())
+		for i := range opts.Renditions {
+			args = append(args, "-map", fmt.Sprintf("[v%d]", i))
+			if hasAudio {
+				args = append(args, "-map", streamMap(audio))
+			}
+		}
+	} else {
+		args = append(args, "-map", streamMap(video))
+		if hasAudio {
+			args = append(args, "-map", streamMap(audio))
+		}
+	}
+
+	copyVideo := len(opts.Renditions) == 0 && video.CodecName == "h264"
+	copyAudio := hasAudio && audio.CodecName == "aac"
+	result.Remuxed = copyVideo && (!hasAudio || copyAudio)
+
+	if copyVideo {
+		args = append(args, "-c:v", "copy")
+	} else {
+		args = append(args,
+			"-c:v", videoEncoders["h264"],
+			"-preset", "veryfast",
+			"-crf", "21",
+			"-pix_fmt", "yuv420p",
+			"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", result.SegmentDuration),
+			"-sc_threshold", "0")
+	}
+	if hasAudio {
+		if copyAudio {
+			args = append(args, "-c:a", "copy")
+		} else {
+			args = append(args, "-c:a", audioEncoders["aac"], "-b:a", "128k")
+		}
+	}
+
+	var streamMap []string
+	for i := 0; i < variants; i++ {
+		if hasAudio {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d,a:%d", i, i))
+		} else {
+			streamMap = append(streamMap, fmt.Sprintf("v:%d", i))
+		}
+	}
+
+	segmentType, segmentExt := "fmp4", "m4s"
+	if result.SegmentType == "ts" {
+		segmentType, segmentExt = "mpegts", "ts"
+	}
+
+	// ffmpeg writes the master playlist next to the output template and refers
+	// to variants relative to it, so everything is kept in a single directory.
+	args = append(args,
+		"-f", "hls",
+		"-hls_time", strconv.Itoa(result.SegmentDuration),
+		"-hls_playlist_type", "vod",
+		"-hls_segment_type", segmentType,
+		"-hls_segment_filename", filepath.Join(result.Dir, "stream_%v_%05d."+segmentExt),
+		"-master_pl_name", masterPlaylistName,
+		"-var_stream_map", strings.Join(streamMap, " "),
+		filepath.Join(result.Dir, "stream_%v.m3u8"))
+
+	logger.Info("Packaging HLS",
+		zap.String("file", inputPath),
+		zap.String("segment_type", result.SegmentType),
+		zap.Int("variants", variants),
+		zap.Bool("remux", result.Remuxed))
+
+	started := time.Now()
+	output, err := runFFmpeg(ctx, "transcode.PackageHLS", args,
+		attribute.String("hls.segment_type", result.SegmentType),
+		attribute.Int("hls.variants", variants))
+	result.Duration = time.Since(started).Seconds()
+	if err != nil {
+		os.RemoveAll(result.Dir)
+		logger.Error("ffmpeg HLS packaging failed", zap.Error(err), zap.String("ffmpeg_output", tail(output)))
+		return nil, fmt.Errorf("failed to package HLS: %w", err)
+	}
+
+	logger.Info("HLS packaged",
+		zap.String("dir", result.Dir),
+		zap.Float64("duration_seconds", result.Duration))
+
+	return result, nil
+}
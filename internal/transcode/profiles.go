@@ -0,0 +1,123 @@
+package transcode
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Profile describes a target output. Streams already matching the profile
+// are copied; the rest are re-encoded with CPU encoders.
+type Profile struct {
+	Name         string `json:"name"`
+	Container    string `json:"container"`
+	VideoCodec   string `json:"video_codec"`
+	AudioCodec   string `json:"audio_codec"`
+	MaxHeight    int    `json:"max_height,omitempty"`
+	Preset       string `json:"preset,omitempty"`
+	CRF          int    `json:"crf,omitempty"`
+	AudioBitrate string `json:"audio_bitrate,omitempty"`
+
+	// KeyframeInterval forces a keyframe every N seconds, as segmenters need.
+	KeyframeInterval int `json:"keyframe_interval,omitempty"`
+}
+
+var builtinProfiles = []Profile{
+	{
+		Name:         "mp4-h264-720",
+		Container:    "mp4",
+		VideoCodec:   "h264",
+		AudioCodec:   "aac",
+		MaxHeight:    720,
+		Preset:       "veryfast",
+		CRF:          23,
+		AudioBitrate: "128k",
+	},
+	{
+		Name:         "webm-vp9",
+		Container:    "webm",
+		VideoCodec:   "vp9",
+		AudioCodec:   "opus",
+		CRF:          32,
+		AudioBitrate: "128k",
+	},
+	{
+		Name:             "hls-ready",
+		Container:        "mp4",
+		VideoCodec:       "h264",
+		AudioCodec:       "aac",
+		Preset:           "veryfast",
+		CRF:              21,
+		AudioBitrate:     "128k",
+		KeyframeInterval: 2,
+	},
+}
+
+// ffmpeg encoders used when a stream has to be re-encoded, keyed by the
+// codec name ffprobe reports.
+var videoEncoders = map[string]string{
+	"h264": "libx264",
+	"hevc": "libx265",
+	"vp9":  "libvpx-vp9",
+	"av1":  "libsvtav1",
+}
+
+var audioEncoders = map[string]string{
+	"aac":  "aac",
+	"opus": "libopus",
+	"mp3":  "libmp3lame",
+	"flac": "flac",
+}
+
+var containers = map[string]bool{
+	"mp4":  true,
+	"webm": true,
+	"mkv":  true,
+}
+
+// loadProfiles returns the built-in profiles overlaid with those from path.
+func loadProfiles(path string) (map[string]Profile, error) {
+	profiles := make(map[string]Profile, len(builtinProfiles))
+	for _, profile := range builtinProfiles {
+		profiles[profile.Name] = profile
+	}
+
+	if path == "" {
+		return profiles, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read profiles file: %w", err)
+	}
+
+	var custom []Profile
+	if err := json.Unmarshal(data, &custom); err != nil {
+		return nil, fmt.Errorf("failed to parse profiles file: %w", err)
+	}
+
+	for _, profile := range custom {
+		if err := profile.validate(); err != nil {
+			return nil, err
+		}
+		profiles[profile.Name] = profile
+	}
+
+	return profiles, nil
+}
+
+func (p Profile) validate() error {
+	if p.Name == "" {
+		return fmt.Errorf("profile name is required")
+	}
+	if !containers[p.Container] {
+		return fmt.Errorf("profile %s: unsupported container %q", p.Name, p.Container)
+	}
+	if _, ok := videoEncoders[p.VideoCodec]; !ok {
+		return fmt.Errorf("profile %s: unsupported video codec %q", p.Name, p.VideoCodec)
+	}
+	if _, ok := audioEncoders[p.AudioCodec]; !ok {
+		return fmt.Errorf("profile %s: unsupported audio codec %q", p.Name, p.AudioCodec)
+	}
+	return nil
+}
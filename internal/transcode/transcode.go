@@ -0,0 +1,306 @@
+package transcode
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/tracing"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+var tracer = otel.Tracer("github.com/callmemars1/ytdlp-http/internal/transcode")
+
+var ErrUnknownProfile = errors.New("unknown output profile")
+
+type Service struct {
+	config   *configurations.TranscodeConfig
+	profiles map[string]Profile
+	slots    chan struct{}
+	logger   *zap.Logger
+}
+
+// Result records how a profile was applied; it ends up in the metadata sidecar.
+type Result struct {
+	Profile     string  `json:"profile"`
+	Container   string  `json:"container"`
+	VideoCodec  string  `json:"video_codec,omitempty"`
+	AudioCodec  string  `json:"audio_codec,omitempty"`
+	VideoCopied bool    `json:"video_copied"`
+	AudioCopied bool    `json:"audio_copied"`
+	Remuxed     bool    `json:"remuxed"`
+	Duration    float64 `json:"duration_seconds"`
+}
+
+type probeStream struct {
+	Index       int    `json:"index"`
+	CodecType   string `json:"codec_type"`
+	CodecName   string `json:"codec_name"`
+	Height      int    `json:"height"`
+	Disposition struct {
+		AttachedPic int `json:"attached_pic"`
+	} `json:"disposition"`
+}
+
+// mediaStreams returns the first video and audio streams, or nil. Cover art
+// embedded as an attached picture is not a video stream.
+func mediaStreams(streams []probeStream) (video, audio *probeStream) {
+	for i := range streams {
+		stream := &streams[i]
+		switch {
+		case stream.CodecType == "video" && stream.Disposition.AttachedPic == 0 && video == nil:
+			video = stream
+		case stream.CodecType == "audio" && audio == nil:
+			audio = stream
+		}
+	}
+	return video, audio
+}
+
+// streamMap returns the -map argument selecting stream from the first input.
+func streamMap(stream *probeStream) string {
+	return "0:" + strconv.Itoa(stream.Index)
+}
+
+func NewService(cfg *configurations.TranscodeConfig, logger *zap.Logger) (*Service, error) {
+	profiles, err := loadProfiles(cfg.ProfilesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	concurrency := cfg.Concurrency
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+
+	return &Service{
+		config:   cfg,
+		profiles: profiles,
+		slots:    make(chan struct{}, concurrency),
+		logger:   logger,
+	}, nil
+}
+
+// Profiles returns the configured profiles sorted by name.
+func (s *Service) Profiles() []Profile {
+	profiles := make([]Profile, 0, len(s.profiles))
+	for _, profile := range s.profiles {
+		profiles = append(profiles, profile)
+	}
+	sort.Slice(profiles, func(i, j int) bool {
+		return profiles[i].Name < profiles[j].Name
+	})
+	return profiles
+}
+
+func (s *Service) Profile(name string) (Profile, error) {
+	profile, ok := s.profiles[name]
+	if !ok {
+		return Profile{}, fmt.Errorf("%w: %s", ErrUnknownProfile, name)
+	}
+	return profile, nil
+}
+
+// Apply converts inputPath to the named profile next to the input, removes
+// the input and returns the new path. Streams that already match are copied
+// so a pure remux never re-encodes.
+func (s *Service) Apply(ctx context.Context, inputPath, profileName string) (string, *Result, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	profile, err := s.Profile(profileName)
+	if err != nil {
+		return "", nil, err
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+		defer func() { <-s.slots }()
+	case <-ctx.Done():
+		return "", nil, ctx.Err()
+	}
+
+	streams, err := probe(ctx, inputPath)
+	if err != nil {
+		return "", nil, err
+	}
+
+	result := &Result{
+		Profile:    profile.Name,
+		Container:  profile.Container,
+		VideoCodec: profile.VideoCodec,
+		AudioCodec: profile.AudioCodec,
+	}
+
+	video, audio := mediaStreams(streams)
+	if video != nil {
+		result.VideoCopied = video.CodecName == profile.VideoCodec &&
+			(profile.MaxHeight == 0 || video.Height <= profile.MaxHeight) &&
+			profile.KeyframeInterval == 0
+	} else {
+		result.VideoCodec = ""
+	}
+	if audio != nil {
+		result.AudioCopied = audio.CodecName == profile.AudioCodec
+	} else {
+		result.AudioCodec = ""
+	}
+	result.Remuxed = (video == nil || result.VideoCopied) && (audio == nil || result.AudioCopied)
+
+	stem := strings.TrimSuffix(inputPath, filepath.Ext(inputPath))
+	outputPath := stem + "." + profile.Container
+	workPath := stem + ".transcode." + profile.Container
+
+	args := s.ffmpegArgs(profile, result, video, audio, inputPath, workPath)
+
+	logger.Info("Applying output profile",
+		zap.String("profile", profile.Name),
+		zap.String("file", inputPath),
+		zap.Bool("remux", result.Remuxed))
+
+	started := time.Now()
+	output, err := runFFmpeg(ctx, "transcode.Apply", args, attribute.String("transcode.profile", profile.Name))
+	result.Duration = time.Since(started).Seconds()
+	if err != nil {
+		os.Remove(workPath)
+		logger.Error("ffmpeg failed", zap.Error(err), zap.String("profile", profile.Name), zap.String("ffmpeg_output", tail(output)))
+		return "", nil, fmt.Errorf("failed to apply profile %s: %w", profile.Name, err)
+	}
+
+	if err := os.Remove(inputPath); err != nil {
+		logger.Warn("Failed to remove pre-transcode file", zap.Error(err), zap.String("file", inputPath))
+	}
+	if err := os.Rename(workPath, outputPath); err != nil {
+		return "", nil, fmt.Errorf("failed to move transcoded file: %w", err)
+	}
+
+	logger.Info("Output profile applied",
+		zap.String("profile", profile.Name),
+		zap.String("file", outputPath),
+		zap.Bool("remuxed", result.Remuxed),
+		zap.Float64("duration_seconds", result.Duration))
+
+	return outputPath, result, nil
+}
+
+func (s *Service) ffmpegArgs(profile Profile, result *Result, video, audio *probeStream, inputPath, outputPath string) []string {
+	args := []string{"-hide_banner", "-nostdin", "-y", "-i", inputPath}
+	if video != nil {
+		args = append(args, "-map", streamMap(video))
+	}
+	if audio != nil {
+		args = append(args, "-map", streamMap(audio))
+	}
+
+	if s.config.Threads > 0 {
+		args = append(args, "-threads", strconv.Itoa(s.config.Threads))
+	}
+
+	if result.VideoCopied {
+		args = append(args, "-c:v", "copy")
+	} else if result.VideoCodec != "" {
+		args = append(args, "-c:v", videoEncoders[profile.VideoCodec])
+		if profile.Preset != "" {
+			args = append(args, "-preset", profile.Preset)
+		}
+		if profile.CRF > 0 {
+			args = append(args, "-crf", strconv.Itoa(profile.CRF))
+			if profile.VideoCodec == "vp9" {
+				// Constant quality mode for libvpx-vp9.
+				args = append(args, "-b:v", "0")
+			}
+		}
+		if profile.VideoCodec == "vp9" {
+			// libvpx-vp9 defaults to its slowest settings on a single thread.
+			args = append(args, "-deadline", "good", "-cpu-used", "4", "-row-mt", "1")
+		}
+		if profile.VideoCodec == "h264" {
+			args = append(args, "-pix_fmt", "yuv420p")
+		}
+		if profile.MaxHeight > 0 {
+			args = append(args, "-vf", fmt.Sprintf("scale=-2:'min(%d,ih)'", profile.MaxHeight))
+		}
+		if profile.KeyframeInterval > 0 {
+			args = append(args,
+				"-force_key_frames", fmt.Sprintf("expr:gte(t,n_forced*%d)", profile.KeyframeInterval),
+				"-sc_threshold", "0")
+		}
+	}
+
+	if result.AudioCopied {
+		args = append(args, "-c:a", "copy")
+	} else if result.AudioCodec != "" {
+		args = append(args, "-c:a", audioEncoders[profile.AudioCodec])
+		if profile.AudioBitrate != "" {
+			args = append(args, "-b:a", profile.AudioBitrate)
+		}
+	}
+
+	if profile.Container == "mp4" {
+		args = append(args, "-movflags", "+faststart")
+	}
+
+	return append(args, outputPath)
+}
+
+// runFFmpeg runs ffmpeg inside a span named name. Only flag names are
+// exported, as values hold local paths and title-derived file names.
+func runFFmpeg(ctx context.Context, name string, args []string, attrs ...attribute.KeyValue) ([]byte, error) {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(
+		append(attrs, attribute.StringSlice("ffmpeg.flags", argFlags(args)))...,
+	))
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	tracing.End(span, err)
+	return output, err
+}
+
+// argFlags returns the option names of an ffmpeg invocation, without their
+// values or the input and output paths.
+func argFlags(args []string) []string {
+	var flags []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			flags = append(flags, arg)
+		}
+	}
+	return flags
+}
+
+func probe(ctx context.Context, path string) ([]probeStream, error) {
+	output, err := exec.CommandContext(ctx, "ffprobe",
+		"-v", "error",
+		"-show_entries", "stream=index,codec_type,codec_name,height:stream_disposition=attached_pic",
+		"-of", "json",
+		path).Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to probe media: %w", err)
+	}
+
+	var probed struct {
+		Streams []probeStream `json:"streams"`
+	}
+	if err := json.Unmarshal(output, &probed); err != nil {
+		return nil, fmt.Errorf("failed to parse probe output: %w", err)
+	}
+	return probed.Streams, nil
+}
+
+// tail keeps the end of ffmpeg output, where the actual error is printed.
+func tail(output []byte) string {
+	const max = 2000
+	if len(output) > max {
+		output = output[len(output)-max:]
+	}
+	return string(output)
+}
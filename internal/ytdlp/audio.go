@@ -0,0 +1,111 @@
+package ytdlp
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/tracing"
+	"go.uber.org/zap"
+)
+
+// loudnorm resamples to 192 kHz internally and outputs that rate unless one
+// is set, so normalized audio defaults to this rate.
+const normalizedSampleRate = 48000
+
+var audioEncoders = map[string]string{
+	"mp3":  "libmp3lame",
+	"m4a":  "aac",
+	"aac":  "aac",
+	"opus": "libopus",
+	"flac": "flac",
+	"wav":  "pcm_s16le",
+}
+
+// audioVBRScales maps yt-dlp's VBR levels, 0 (best) to 10 (worst), onto
+// the -q:a scale of each encoder as {worst, best}, like yt-dlp does. Other
+// lossy encoders only take a bitrate.
+var audioVBRScales = map[string][2]float64{
+	"libmp3lame": {10, 0},
+	"aac":        {0.1, 4},
+}
+
+// losslessAudioCodecs ignore the quality setting.
+var losslessAudioCodecs = map[string]bool{"flac": true, "wav": true}
+
+// reencodes reports whether the extracted audio needs a processing step of
+// its own. yt-dlp copies the audio stream when the source codec already
+// matches, like opus to opus, and then ignores postprocessor arguments.
+func (o *AudioOptions) reencodes() bool {
+	return o != nil && (o.Normalize || o.SampleRate != 0)
+}
+
+// processArgs returns the ffmpeg arguments re-encoding inputPath into
+// outputPath with normalization and resampling applied. Cover art and tags
+// are copied as they are.
+func (o *AudioOptions) processArgs(inputPath, outputPath string) []string {
+	codec := strings.ToLower(o.Codec)
+	if codec == "" {
+		codec = "mp3"
+	}
+
+	encoder := audioEncoders[codec]
+	args := []string{"-hide_banner", "-nostdin", "-y", "-i", inputPath,
+		"-map", "0", "-c", "copy", "-c:a", encoder}
+
+	switch {
+	case o.Quality == "" || losslessAudioCodecs[codec]:
+	case strings.HasSuffix(strings.ToUpper(o.Quality), "K"):
+		args = append(args, "-b:a", strings.ToLower(o.Quality))
+	default:
+		// Validated by args: only encoders with a VBR scale take a level.
+		level, _ := strconv.Atoi(o.Quality)
+		scale := audioVBRScales[encoder]
+		q := scale[1] + (scale[0]-scale[1])*float64(level)/10
+		args = append(args, "-q:a", strconv.FormatFloat(q, 'g', 3, 64))
+	}
+
+	if o.Normalize {
+		args = append(args, "-af", loudnormFilter)
+	}
+	sampleRate := o.SampleRate
+	if sampleRate == 0 {
+		sampleRate = normalizedSampleRate
+	}
+	args = append(args, "-ar", strconv.Itoa(sampleRate))
+
+	return append(args, outputPath)
+}
+
+// processAudio re-encodes an extracted audio file in place.
+func (s *Service) processAudio(ctx context.Context, path string, o *AudioOptions) error {
+	logger := logging.FromContext(ctx, s.logger)
+	ext := filepath.Ext(path)
+	workPath := strings.TrimSuffix(path, ext) + ".process" + ext
+
+	args := o.processArgs(path, workPath)
+	logger.Info("Processing audio", zap.String("file", path), zap.Bool("normalize", o.Normalize))
+
+	ctx, span := tracer.Start(ctx, "ytdlp.processAudio")
+	output, err := exec.CommandContext(ctx, "ffmpeg", args...).CombinedOutput()
+	tracing.End(span, err)
+	if err != nil {
+		os.Remove(workPath)
+		logger.Error("ffmpeg failed", zap.Error(err), zap.String("ffmpeg_output", string(output)))
+		return &Error{
+			Code:    CodeDownloadFailed,
+			Message: "Failed to process audio",
+			Output:  string(output),
+			Err:     fmt.Errorf("ffmpeg failed: %w", err),
+		}
+	}
+	if err := os.Rename(workPath, path); err != nil {
+		return fmt.Errorf("failed to move processed audio: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package ytdlp
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestAudioProcessArgsQuality(t *testing.T) {
+	tests := []struct {
+		name    string
+		options AudioOptions
+		want    []string
+	}{
+		{"mp3 level", AudioOptions{Codec: "mp3", Quality: "2", Normalize: true}, []string{"-q:a", "2"}},
+		{"mp3 bitrate", AudioOptions{Codec: "mp3", Quality: "192K", SampleRate: 44100}, []string{"-b:a", "192k"}},
+		{"aac best level", AudioOptions{Codec: "aac", Quality: "0", Normalize: true}, []string{"-q:a", "4"}},
+		{"m4a worst level", AudioOptions{Codec: "m4a", Quality: "10", Normalize: true}, []string{"-q:a", "0.1"}},
+		{"opus bitrate", AudioOptions{Codec: "opus", Quality: "96k", Normalize: true}, []string{"-b:a", "96k"}},
+		{"flac ignores quality", AudioOptions{Codec: "flac", Quality: "5", SampleRate: 44100}, nil},
+		{"no quality", AudioOptions{Codec: "opus", Normalize: true}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.options.args(); err != nil {
+				t.Fatal(err)
+			}
+			args := tt.options.processArgs("in", "out")
+			var got []string
+			for i, arg := range args {
+				if arg == "-q:a" || arg == "-b:a" {
+					got = args[i : i+2]
+				}
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("quality args = %v, want %v in %s", got, tt.want, strings.Join(args, " "))
+			}
+		})
+	}
+}
+
+func TestAudioArgsRejectsOpusLevel(t *testing.T) {
+	options := AudioOptions{Codec: "opus", Quality: "5", Normalize: true}
+	if _, err := options.args(); !errors.Is(err, ErrInvalidOptions) {
+		t.Errorf("args() error = %v, want ErrInvalidOptions", err)
+	}
+
+	// Without processing, yt-dlp handles the quality itself.
+	options.Normalize = false
+	if _, err := options.args(); err != nil {
+		t.Errorf("args() error = %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package ytdlp
+
+import (
+	"context"
+	"errors"
+	"regexp"
+)
+
+// ErrorCode is a stable identifier for a class of yt-dlp failures.
+type ErrorCode string
+
+const (
+	CodeUnsupportedURL    ErrorCode = "unsupported_url"
+	CodeVideoUnavailable  ErrorCode = "video_unavailable"
+	CodePrivateVideo      ErrorCode = "private_video"
+	CodeGeoBlocked        ErrorCode = "geo_blocked"
+	CodeAgeRestricted     ErrorCode = "age_restricted"
+	CodeLoginRequired     ErrorCode = "login_required"
+	CodeRateLimited       ErrorCode = "rate_limited"
+	CodeFileTooLarge      ErrorCode = "file_too_large"
+	CodeFormatUnavailable ErrorCode = "format_unavailable"
+	CodeNetworkError      ErrorCode = "network_error"
+	CodeTimeout           ErrorCode = "timeout"
+	CodeDownloadFailed    ErrorCode = "download_failed"
+)
+
+// Error is a classified yt-dlp failure. Output holds the raw (redacted)
+// yt-dlp output and is not part of the error message.
+type Error struct {
+	Code     ErrorCode
+	Message  string
+	Output   string
+	Attempts int
+	Err      error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Transient reports whether running yt-dlp again may succeed.
+func (e *Error) Transient() bool {
+	return e.Code == CodeNetworkError || e.Code == CodeRateLimited
+}
+
+func isTransient(err error) bool {
+	var ytdlpErr *Error
+	return errors.As(err, &ytdlpErr) && ytdlpErr.Transient()
+}
+
+// Patterns are checked in order; more specific causes come first because
+// yt-dlp often prefixes them with a generic "Video unavailable".
+var errorPatterns = []struct {
+	code    ErrorCode
+	pattern *regexp.Regexp
+}{
+	{CodeUnsupportedURL, regexp.MustCompile(`(?i)unsupported url|is not a valid url`)},
+	{CodeFileTooLarge, regexp.MustCompile(`(?i)larger than max-filesize`)},
+	{CodeFormatUnavailable, regexp.MustCompile(`(?i)requested format (is )?not available|no video formats found`)},
+	{CodeGeoBlocked, regexp.MustCompile(`(?i)available (in|from) your (country|location)|geo.?restrict|blocked it in your country`)},
+	{CodeAgeRestricted, regexp.MustCompile(`(?i)confirm your age|age.?restricted|inappropriate for some users`)},
+	{CodeRateLimited, regexp.MustCompile(`(?i)http error 429|too many requests|confirm you.re not a bot|rate.?limit`)},
+	{CodePrivateVideo, regexp.MustCompile(`(?i)private video|video is private`)},
+	{CodeLoginRequired, regexp.MustCompile(`(?i)login required|requires? authentication|sign in|members.only|join this channel|available for registered users|use --cookies|--username`)},
+	{CodeVideoUnavailable, regexp.MustCompile(`(?i)video unavailable|has been removed|no longer available|does not exist|http error 404`)},
+	{CodeNetworkError, regexp.MustCompile(`(?i)unable to download webpage|connection (refused|reset|aborted)|timed out|name or service not known|temporary failure in name resolution|network is unreachable|unable to connect to proxy|http error 5\d\d`)},
+}
+
+var errorMessages = map[ErrorCode]string{
+	CodeUnsupportedURL:    "URL is not supported",
+	CodeVideoUnavailable:  "Video is unavailable",
+	CodePrivateVideo:      "Video is private",
+	CodeGeoBlocked:        "Video is not available in this region",
+	CodeAgeRestricted:     "Video is age-restricted",
+	CodeLoginRequired:     "Video requires login",
+	CodeRateLimited:       "Site is rate limiting downloads",
+	CodeFileTooLarge:      "File exceeds the maximum file size",
+	CodeFormatUnavailable: "Requested format is not available",
+	CodeNetworkError:      "Network error while downloading",
+	CodeTimeout:           "Download timed out",
+	CodeDownloadFailed:    "Download failed",
+}
+
+// classify turns a failed yt-dlp run into an *Error. The message is the fixed
+// text for the code; yt-dlp's own error lines may name URLs, cookie files or
+// proxies and stay in Output.
+func classify(ctx context.Context, output string, err error) *Error {
+	code := CodeDownloadFailed
+	switch {
+	case errors.Is(ctx.Err(), context.DeadlineExceeded):
+		code = CodeTimeout
+	default:
+		for _, candidate := range errorPatterns {
+			if candidate.pattern.MatchString(output) {
+				code = candidate.code
+				break
+			}
+		}
+	}
+
+	return &Error{
+		Code:    code,
+		Message: errorMessages[code],
+		Output:  output,
+		Err:     err,
+	}
+}
@@ -0,0 +1,216 @@
+package ytdlp
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// FormatSelector is a structured replacement for raw yt-dlp format strings.
+// It is compiled into a single --format expression plus an optional
+// --format-sort and --merge-output-format.
+type FormatSelector struct {
+	MaxHeight   int      `json:"max_height,omitempty"`
+	MaxFPS      int      `json:"max_fps,omitempty"`
+	VideoCodecs []string `json:"video_codecs,omitempty"`
+	AudioCodecs []string `json:"audio_codecs,omitempty"`
+	Container   string   `json:"container,omitempty"`
+	Video       *bool    `json:"video,omitempty"`
+	Audio       *bool    `json:"audio,omitempty"`
+	MaxFilesize string   `json:"max_filesize,omitempty"`
+}
+
+// FormatSelection is what was actually passed to yt-dlp, echoed back to
+// callers.
+type FormatSelection struct {
+	Format            string `json:"format"`
+	Sort              string `json:"sort,omitempty"`
+	MergeOutputFormat string `json:"merge_output_format,omitempty"`
+}
+
+const maxPreferredCodecs = 4
+
+var (
+	codecPattern    = regexp.MustCompile(`^[a-z0-9.]+$`)
+	filesizePattern = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?[KMGT]?$`)
+)
+
+var containerSorts = map[string]string{
+	"mp4":  "ext:mp4:m4a",
+	"webm": "ext:webm:webm",
+	"mkv":  "",
+}
+
+// FormatSelection compiles the format-related options. Format, Quality,
+// VideoOnly and Selector are mutually exclusive; nil means yt-dlp defaults.
+func (o *Options) FormatSelection() (*FormatSelection, error) {
+	if o == nil {
+		return nil, nil
+	}
+
+	set := 0
+	for _, isSet := range []bool{o.Format != "", o.Quality != "", o.VideoOnly, o.Selector != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set > 1 {
+		return nil, fmt.Errorf("%w: format, quality, video_only and selector are mutually exclusive", ErrInvalidOptions)
+	}
+
+	switch {
+	case o.Format != "":
+		return &FormatSelection{Format: o.Format}, nil
+	case o.Quality != "":
+		height, err := strconv.Atoi(o.Quality)
+		if err != nil || height <= 0 {
+			return nil, fmt.Errorf("%w: quality must be a maximum height in pixels", ErrInvalidOptions)
+		}
+		return (&FormatSelector{MaxHeight: height}).compile()
+	case o.VideoOnly:
+		// Historical meaning of video_only: best quality up to 720p.
+		return (&FormatSelector{MaxHeight: 720}).compile()
+	case o.Selector != nil:
+		if o.Audio != nil || o.AudioOnly {
+			if o.Selector.Audio != nil && !*o.Selector.Audio {
+				return nil, fmt.Errorf("%w: audio extraction requires a selector with audio", ErrInvalidOptions)
+			}
+			if o.Selector.Container != "" {
+				return nil, fmt.Errorf("%w: container does not apply to audio extraction, use audio.codec", ErrInvalidOptions)
+			}
+		}
+		return o.Selector.compile()
+	}
+
+	return nil, nil
+}
+
+func (s *FormatSelector) compile() (*FormatSelection, error) {
+	if err := s.validate(); err != nil {
+		return nil, err
+	}
+
+	wantVideo := s.Video == nil || *s.Video
+	wantAudio := s.Audio == nil || *s.Audio
+
+	var videoFilter, audioFilter strings.Builder
+	if s.MaxHeight > 0 {
+		fmt.Fprintf(&videoFilter, "[height<=%d]", s.MaxHeight)
+	}
+	if s.MaxFPS > 0 {
+		fmt.Fprintf(&videoFilter, "[fps<=%d]", s.MaxFPS)
+	}
+	if s.MaxFilesize != "" {
+		// "<=?" keeps formats whose size is unknown up front.
+		fmt.Fprintf(&videoFilter, "[filesize<=?%s]", s.MaxFilesize)
+		fmt.Fprintf(&audioFilter, "[filesize<=?%s]", s.MaxFilesize)
+	}
+
+	videoCodecs := codecFilters("vcodec", s.VideoCodecs)
+	audioCodecs := codecFilters("acodec", s.AudioCodecs)
+
+	var alternatives []string
+	switch {
+	case wantVideo && wantAudio:
+		for _, vc := range videoCodecs {
+			for _, ac := range audioCodecs {
+				alternatives = append(alternatives, fmt.Sprintf("bv*%s%s+ba%s%s", videoFilter.String(), vc, audioFilter.String(), ac))
+			}
+		}
+		alternatives = append(alternatives, fmt.Sprintf("b%s", videoFilter.String()))
+	case wantVideo:
+		for _, vc := range videoCodecs {
+			alternatives = append(alternatives, fmt.Sprintf("bv%s%s", videoFilter.String(), vc))
+		}
+	case wantAudio:
+		for _, ac := range audioCodecs {
+			alternatives = append(alternatives, fmt.Sprintf("ba%s%s", audioFilter.String(), ac))
+		}
+		// Sites without separate audio streams only offer combined formats.
+		alternatives = append(alternatives, fmt.Sprintf("b%s", audioFilter.String()))
+	}
+
+	selection := &FormatSelection{
+		Format: strings.Join(dedupe(alternatives), "/"),
+	}
+	if s.Container != "" {
+		selection.Sort = containerSorts[s.Container]
+		if wantAudio {
+			selection.MergeOutputFormat = s.Container
+		}
+	}
+
+	return selection, nil
+}
+
+func (s *FormatSelector) validate() error {
+	wantVideo := s.Video == nil || *s.Video
+	wantAudio := s.Audio == nil || *s.Audio
+
+	if !wantVideo && !wantAudio {
+		return fmt.Errorf("%w: selector must include video, audio or both", ErrInvalidOptions)
+	}
+	if s.MaxHeight < 0 || s.MaxFPS < 0 {
+		return fmt.Errorf("%w: max_height and max_fps must be positive", ErrInvalidOptions)
+	}
+	if !wantVideo && (s.MaxHeight > 0 || s.MaxFPS > 0 || len(s.VideoCodecs) > 0) {
+		return fmt.Errorf("%w: video constraints require video", ErrInvalidOptions)
+	}
+	if !wantAudio && len(s.AudioCodecs) > 0 {
+		return fmt.Errorf("%w: audio_codecs require audio", ErrInvalidOptions)
+	}
+	if len(s.VideoCodecs) > maxPreferredCodecs || len(s.AudioCodecs) > maxPreferredCodecs {
+		return fmt.Errorf("%w: at most %d preferred codecs per stream", ErrInvalidOptions, maxPreferredCodecs)
+	}
+	for _, codec := range append(append([]string{}, s.VideoCodecs...), s.AudioCodecs...) {
+		if !codecPattern.MatchString(codec) {
+			return fmt.Errorf("%w: invalid codec %q", ErrInvalidOptions, codec)
+		}
+	}
+	if s.Container != "" {
+		if _, ok := containerSorts[s.Container]; !ok {
+			return fmt.Errorf("%w: unsupported container %q, use mp4, webm or mkv", ErrInvalidOptions, s.Container)
+		}
+		if !wantVideo {
+			return fmt.Errorf("%w: container applies to video, use audio.codec for audio-only output", ErrInvalidOptions)
+		}
+	}
+	if s.MaxFilesize != "" && !filesizePattern.MatchString(strings.ToUpper(s.MaxFilesize)) {
+		return fmt.Errorf("%w: max_filesize must look like 500M or 2G", ErrInvalidOptions)
+	}
+	return nil
+}
+
+func (s *FormatSelection) args() []string {
+	args := []string{"--format", s.Format}
+	if s.Sort != "" {
+		args = append(args, "--format-sort", s.Sort)
+	}
+	if s.MergeOutputFormat != "" {
+		args = append(args, "--merge-output-format", s.MergeOutputFormat)
+	}
+	return args
+}
+
+// codecFilters returns one filter per preferred codec, in order, followed by
+// an unconstrained fallback.
+func codecFilters(field string, codecs []string) []string {
+	filters := make([]string, 0, len(codecs)+1)
+	for _, codec := range codecs {
+		filters = append(filters, fmt.Sprintf("[%s^=%s]", field, codec))
+	}
+	return append(filters, "")
+}
+
+func dedupe(values []string) []string {
+	seen := make(map[string]bool, len(values))
+	result := values[:0]
+	for _, value := range values {
+		if !seen[value] {
+			seen[value] = true
+			result = append(result, value)
+		}
+	}
+	return result
+}
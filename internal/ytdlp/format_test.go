@@ -0,0 +1,142 @@
+package ytdlp
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormatSelectorCompile(t *testing.T) {
+	yes, no := true, false
+
+	tests := []struct {
+		name     string
+		selector FormatSelector
+		want     FormatSelection
+	}{
+		{
+			name:     "defaults",
+			selector: FormatSelector{},
+			want:     FormatSelection{Format: "bv*+ba/b"},
+		},
+		{
+			name:     "max height and fps",
+			selector: FormatSelector{MaxHeight: 720, MaxFPS: 30},
+			want:     FormatSelection{Format: "bv*[height<=720][fps<=30]+ba/b[height<=720][fps<=30]"},
+		},
+		{
+			name:     "preferred codecs",
+			selector: FormatSelector{VideoCodecs: []string{"avc1"}, AudioCodecs: []string{"mp4a"}},
+			want: FormatSelection{Format: "bv*[vcodec^=avc1]+ba[acodec^=mp4a]/bv*[vcodec^=avc1]+ba/" +
+				"bv*+ba[acodec^=mp4a]/bv*+ba/b"},
+		},
+		{
+			name:     "container",
+			selector: FormatSelector{MaxHeight: 1080, Container: "mp4"},
+			want: FormatSelection{
+				Format:            "bv*[height<=1080]+ba/b[height<=1080]",
+				Sort:              "ext:mp4:m4a",
+				MergeOutputFormat: "mp4",
+			},
+		},
+		{
+			name:     "max filesize keeps unknown sizes",
+			selector: FormatSelector{MaxFilesize: "500M"},
+			want:     FormatSelection{Format: "bv*[filesize<=?500M]+ba[filesize<=?500M]/b[filesize<=?500M]"},
+		},
+		{
+			name:     "video only",
+			selector: FormatSelector{Audio: &no, VideoCodecs: []string{"vp9"}, Container: "webm"},
+			want:     FormatSelection{Format: "bv[vcodec^=vp9]/bv", Sort: "ext:webm:webm"},
+		},
+		{
+			name:     "audio only falls back to combined formats",
+			selector: FormatSelector{Video: &no, Audio: &yes, AudioCodecs: []string{"opus"}},
+			want:     FormatSelection{Format: "ba[acodec^=opus]/ba/b"},
+		},
+		{
+			name:     "audio only with max filesize",
+			selector: FormatSelector{Video: &no, MaxFilesize: "50M"},
+			want:     FormatSelection{Format: "ba[filesize<=?50M]/b[filesize<=?50M]"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.selector.compile()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if *got != tt.want {
+				t.Errorf("compile() = %+v, want %+v", *got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatSelectorValidate(t *testing.T) {
+	no := false
+
+	tests := []struct {
+		name     string
+		selector FormatSelector
+	}{
+		{"nothing wanted", FormatSelector{Video: &no, Audio: &no}},
+		{"negative height", FormatSelector{MaxHeight: -1}},
+		{"video constraint without video", FormatSelector{Video: &no, MaxHeight: 720}},
+		{"audio codecs without audio", FormatSelector{Audio: &no, AudioCodecs: []string{"opus"}}},
+		{"too many codecs", FormatSelector{VideoCodecs: []string{"a", "b", "c", "d", "e"}}},
+		{"codec injection", FormatSelector{VideoCodecs: []string{"avc1]/b[height>0"}}},
+		{"unknown container", FormatSelector{Container: "avi"}},
+		{"container without video", FormatSelector{Video: &no, Container: "mp4"}},
+		{"bad filesize", FormatSelector{MaxFilesize: "lots"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.selector.compile(); !errors.Is(err, ErrInvalidOptions) {
+				t.Errorf("compile() error = %v, want ErrInvalidOptions", err)
+			}
+		})
+	}
+}
+
+func TestFormatSelection(t *testing.T) {
+	no := false
+
+	tests := []struct {
+		name    string
+		options *Options
+		want    string
+		wantErr bool
+	}{
+		{"nil options", nil, "", false},
+		{"no format options", &Options{}, "", false},
+		{"raw format", &Options{Format: "best"}, "best", false},
+		{"quality", &Options{Quality: "480"}, "bv*[height<=480]+ba/b[height<=480]", false},
+		{"video_only", &Options{VideoOnly: true}, "bv*[height<=720]+ba/b[height<=720]", false},
+		{"invalid quality", &Options{Quality: "hd"}, "", true},
+		{"mutually exclusive", &Options{Format: "best", Quality: "720"}, "", true},
+		{"audio extraction with audio-only selector", &Options{AudioOnly: true, Selector: &FormatSelector{Video: &no}}, "ba/b", false},
+		{"audio extraction without audio", &Options{AudioOnly: true, Selector: &FormatSelector{Audio: &no}}, "", true},
+		{"audio extraction with container", &Options{Audio: &AudioOptions{}, Selector: &FormatSelector{Container: "mp4"}}, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.options.FormatSelection()
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidOptions) {
+					t.Errorf("error = %v, want ErrInvalidOptions", err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			format := ""
+			if got != nil {
+				format = got.Format
+			}
+			if format != tt.want {
+				t.Errorf("format = %q, want %q", format, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,178 @@
+package ytdlp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/callmemars1/ytdlp-http/internal/utils"
+	"go.uber.org/zap"
+)
+
+// downloadDirPrefix marks per-job directories under the temp dir. Only these
+// are ever removed, so pointing YTDLP_TEMP_DIR at a shared path is safe.
+const downloadDirPrefix = "download_"
+
+type downloadDir struct {
+	path    string
+	size    int64
+	modTime time.Time
+}
+
+// StartJanitor reclaims orphaned download directories immediately and then
+// every JanitorInterval until Shutdown is called.
+func (s *Service) StartJanitor() {
+	ctx, cancel := context.WithCancel(context.Background())
+	s.stopJanitor = cancel
+
+	s.reclaim()
+	if s.config.JanitorInterval <= 0 {
+		return
+	}
+
+	go func() {
+		ticker := time.NewTicker(s.config.JanitorInterval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				s.reclaim()
+			}
+		}
+	}()
+}
+
+// reclaim removes download directories not owned by an active job that are
+// older than JanitorMaxAge, then the oldest ones until the temp dir fits in
+// JanitorMaxBytes.
+func (s *Service) reclaim() {
+	dirs, err := s.listDownloadDirs()
+	if err != nil {
+		s.logger.Error("Janitor failed to list temp directory", zap.Error(err), zap.String("path", s.tmpDir))
+		return
+	}
+
+	var total int64
+	for _, dir := range dirs {
+		total += dir.size
+	}
+
+	var removed int
+	var reclaimed int64
+	remove := func(dir downloadDir, reason string) {
+		if err := os.RemoveAll(dir.path); err != nil {
+			s.logger.Warn("Janitor failed to remove directory", zap.Error(err), zap.String("path", dir.path))
+			return
+		}
+		s.logger.Info("Janitor removed orphaned download directory",
+			zap.String("path", dir.path),
+			zap.String("reason", reason),
+			zap.Int64("size", dir.size),
+			zap.Time("last_modified", dir.modTime))
+		removed++
+		reclaimed += dir.size
+		total -= dir.size
+	}
+
+	// Oldest first, so the size pass below evicts in age order.
+	sort.Slice(dirs, func(i, j int) bool {
+		return dirs[i].modTime.Before(dirs[j].modTime)
+	})
+
+	var kept []downloadDir
+	for _, dir := range dirs {
+		if s.isActiveJob(dir.path) {
+			continue
+		}
+		if s.config.JanitorMaxAge > 0 && time.Since(dir.modTime) > s.config.JanitorMaxAge {
+			remove(dir, "max_age")
+			continue
+		}
+		kept = append(kept, dir)
+	}
+
+	if s.config.JanitorMaxBytes > 0 {
+		for _, dir := range kept {
+			if total <= s.config.JanitorMaxBytes {
+				break
+			}
+			remove(dir, "max_total_size")
+		}
+	}
+
+	if removed > 0 {
+		s.logger.Info("Janitor reclaimed temp disk space",
+			zap.Int("directories", removed),
+			zap.Int64("bytes", reclaimed),
+			zap.Int64("remaining_bytes", total))
+	}
+}
+
+// sweep removes every download directory regardless of ownership.
+func (s *Service) sweep() error {
+	dirs, err := s.listDownloadDirs()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for _, dir := range dirs {
+		if err := os.RemoveAll(dir.path); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	s.logger.Info("Swept temp download directory", zap.String("path", s.tmpDir), zap.Int("entries", len(dirs)))
+	return errors.Join(errs...)
+}
+
+func (s *Service) listDownloadDirs() ([]downloadDir, error) {
+	entries, err := os.ReadDir(s.tmpDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read temp directory: %w", err)
+	}
+
+	var dirs []downloadDir
+	for _, entry := range entries {
+		if !entry.IsDir() || !strings.HasPrefix(entry.Name(), downloadDirPrefix) {
+			continue
+		}
+
+		path := filepath.Join(s.tmpDir, entry.Name())
+		size, err := utils.DirSize(path)
+		if err != nil {
+			s.logger.Warn("Failed to measure download directory", zap.Error(err), zap.String("path", path))
+		}
+		dirs = append(dirs, downloadDir{
+			path:    path,
+			size:    size,
+			modTime: lastModified(path),
+		})
+	}
+	return dirs, nil
+}
+
+// lastModified returns the newest modification time under root, so a
+// directory with a .part file still being written is not considered stale.
+func lastModified(root string) time.Time {
+	var latest time.Time
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info, err := d.Info(); err == nil && info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+		return nil
+	})
+	return latest
+}
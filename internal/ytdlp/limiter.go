@@ -0,0 +1,139 @@
+package ytdlp
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// limiter bounds concurrent yt-dlp runs, both in total and per host.
+type limiter struct {
+	slots   chan struct{}
+	perHost int
+
+	mu    sync.Mutex
+	hosts map[string]*hostSlots
+}
+
+type hostSlots struct {
+	slots chan struct{}
+	refs  int
+}
+
+func newLimiter(concurrency, perHost int) *limiter {
+	if concurrency <= 0 {
+		concurrency = 1
+	}
+	return &limiter{
+		slots:   make(chan struct{}, concurrency),
+		perHost: perHost,
+		hosts:   make(map[string]*hostSlots),
+	}
+}
+
+// acquire waits for a slot for host and then a global slot, so that a job
+// held back by its host cap does not block jobs for other hosts.
+func (l *limiter) acquire(ctx context.Context, host string) (func(), error) {
+	var hostSlot *hostSlots
+	if l.perHost > 0 {
+		hostSlot = l.host(host)
+		select {
+		case hostSlot.slots <- struct{}{}:
+		case <-ctx.Done():
+			l.releaseHost(host)
+			return nil, ctx.Err()
+		}
+	}
+
+	select {
+	case l.slots <- struct{}{}:
+	case <-ctx.Done():
+		if hostSlot != nil {
+			<-hostSlot.slots
+			l.releaseHost(host)
+		}
+		return nil, ctx.Err()
+	}
+
+	return func() {
+		<-l.slots
+		if hostSlot != nil {
+			<-hostSlot.slots
+			l.releaseHost(host)
+		}
+	}, nil
+}
+
+func (l *limiter) host(host string) *hostSlots {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	slot, ok := l.hosts[host]
+	if !ok {
+		slot = &hostSlots{slots: make(chan struct{}, l.perHost)}
+		l.hosts[host] = slot
+	}
+	slot.refs++
+	return slot
+}
+
+// releaseHost drops the per-host entry once no job is using or waiting on it.
+func (l *limiter) releaseHost(host string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if slot, ok := l.hosts[host]; ok {
+		slot.refs--
+		if slot.refs == 0 {
+			delete(l.hosts, host)
+		}
+	}
+}
+
+// hostKey normalizes the host of rawURL for per-host limits.
+func hostKey(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil || parsed.Hostname() == "" {
+		return rawURL
+	}
+	return strings.TrimPrefix(strings.ToLower(parsed.Hostname()), "www.")
+}
+
+var rateUnits = map[string]float64{
+	"":  1,
+	"K": 1 << 10,
+	"M": 1 << 20,
+	"G": 1 << 30,
+}
+
+// parseRate parses a rate in bytes per second as accepted by yt-dlp's
+// --limit-rate, like "500K" or "4.2M".
+func parseRate(rate string) (int64, error) {
+	rate = strings.TrimSpace(rate)
+	if rate == "" {
+		return 0, nil
+	}
+
+	unit := strings.ToUpper(rate[len(rate)-1:])
+	number := rate
+	if _, ok := rateUnits[unit]; ok {
+		number = rate[:len(rate)-1]
+	} else {
+		unit = ""
+	}
+
+	// ParseFloat accepts NaN and Inf, which have no integer value.
+	value, err := strconv.ParseFloat(number, 64)
+	if err != nil || math.IsNaN(value) || math.IsInf(value, 0) || value <= 0 {
+		return 0, fmt.Errorf("invalid rate %q", rate)
+	}
+	bytes := value * rateUnits[unit]
+	if bytes < 1 || bytes >= math.MaxInt64 {
+		return 0, fmt.Errorf("invalid rate %q", rate)
+	}
+	return int64(bytes), nil
+}
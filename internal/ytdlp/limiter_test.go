@@ -0,0 +1,37 @@
+package ytdlp
+
+import "testing"
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		rate    string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"500", 500, false},
+		{"20K", 20 << 10, false},
+		{"1.5M", 3 << 19, false},
+		{" 2g ", 2 << 30, false},
+		{"0", 0, true},
+		{"-1M", 0, true},
+		{"0.1", 0, true},
+		{"NaN", 0, true},
+		{"nanM", 0, true},
+		{"Inf", 0, true},
+		{"+InfK", 0, true},
+		{"1e30G", 0, true},
+		{"fast", 0, true},
+		{"M", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := parseRate(tt.rate)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("parseRate(%q) error = %v, want error %v", tt.rate, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("parseRate(%q) = %d, want %d", tt.rate, got, tt.want)
+		}
+	}
+}
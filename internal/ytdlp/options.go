@@ -0,0 +1,430 @@
+package ytdlp
+
+import (
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/callmemars1/ytdlp-http/internal/credentials"
+	"github.com/callmemars1/ytdlp-http/internal/proxy"
+)
+
+type Options struct {
+	Selector    *FormatSelector   `json:"selector,omitempty"`
+	Format      string            `json:"format,omitempty"`
+	AudioOnly   bool              `json:"audio_only,omitempty"`
+	VideoOnly   bool              `json:"video_only,omitempty"`
+	Quality     string            `json:"quality,omitempty"`
+	OutputPath  string            `json:"output_path,omitempty"`
+	ExtraArgs   map[string]string `json:"extra_args,omitempty"`
+	MaxFileSize string            `json:"max_file_size,omitempty"`
+	Subtitles   *SubtitleOptions  `json:"subtitles,omitempty"`
+	Audio       *AudioOptions     `json:"audio,omitempty"`
+
+	Thumbnail      bool `json:"thumbnail,omitempty"`
+	EmbedThumbnail bool `json:"embed_thumbnail,omitempty"`
+
+	IncludeRawInfo bool `json:"include_raw_info,omitempty"`
+
+	// Credentials names a server-side credential profile. Handlers resolve it
+	// into CredentialProfile after checking the site and API key scope.
+	Credentials       string               `json:"credentials,omitempty"`
+	CredentialProfile *credentials.Profile `json:"-"`
+
+	// ProxyPool selects a configured proxy pool instead of the default one.
+	ProxyPool string `json:"proxy_pool,omitempty"`
+
+	// RateLimit caps this download's bandwidth, like "2M". The global budget
+	// still applies when it is lower.
+	RateLimit string `json:"rate_limit,omitempty"`
+}
+
+type SubtitleOptions struct {
+	Languages     []string `json:"languages,omitempty"`
+	AutoGenerated bool     `json:"auto_generated,omitempty"`
+	Format        string   `json:"format,omitempty"`
+}
+
+// AudioOptions controls audio extraction. AudioOnly is shorthand for
+// extracting mp3 with default settings.
+type AudioOptions struct {
+	Codec         string `json:"codec,omitempty"`
+	Quality       string `json:"quality,omitempty"`
+	SampleRate    int    `json:"sample_rate,omitempty"`
+	Normalize     bool   `json:"normalize,omitempty"`
+	EmbedMetadata bool   `json:"embed_metadata,omitempty"`
+}
+
+var audioCodecs = map[string]bool{
+	"mp3":  true,
+	"m4a":  true,
+	"aac":  true,
+	"opus": true,
+	"flac": true,
+	"wav":  true,
+}
+
+// Containers that can carry cover art.
+var audioCoverArtCodecs = map[string]bool{
+	"mp3":  true,
+	"m4a":  true,
+	"opus": true,
+	"flac": true,
+}
+
+// EBU R128 single-pass loudness normalization.
+const loudnormFilter = "loudnorm=I=-23:TP=-1:LRA=7"
+
+var audioQualityPattern = regexp.MustCompile(`^(10|[0-9]|[0-9]+[kK])$`)
+
+const cookieJarName = "cookies.txt"
+
+// extraArgFlags are the yt-dlp options extra_args may set, and whether each
+// takes a value. Anything else is rejected, since options such as --exec,
+// --config-locations or --downloader run programs or read server files.
+var extraArgFlags = map[string]bool{
+	"proxy":                  true,
+	"geo-verification-proxy": true,
+	"source-address":         true,
+	"socket-timeout":         true,
+	"force-ipv4":             false,
+	"force-ipv6":             false,
+	"impersonate":            true,
+	"no-check-certificates":  false,
+	"legacy-server-connect":  false,
+	"geo-bypass":             false,
+	"no-geo-bypass":          false,
+	"geo-bypass-country":     true,
+	"xff":                    true,
+	"referer":                true,
+	"user-agent":             true,
+	"extractor-args":         true,
+	"extractor-retries":      true,
+	"retries":                true,
+	"fragment-retries":       true,
+	"concurrent-fragments":   true,
+	"http-chunk-size":        true,
+	"buffer-size":            true,
+	"throttled-rate":         true,
+	"sleep-requests":         true,
+	"sleep-interval":         true,
+	"max-sleep-interval":     true,
+	"min-filesize":           true,
+	"match-filters":          true,
+	"age-limit":              true,
+	"live-from-start":        false,
+	"hls-use-mpegts":         false,
+	"format-sort":            true,
+	"prefer-free-formats":    false,
+	"merge-output-format":    true,
+	"remux-video":            true,
+	"audio-quality":          true,
+	"embed-subs":             false,
+	"embed-metadata":         false,
+	"embed-chapters":         false,
+	"sponsorblock-remove":    true,
+	"sponsorblock-mark":      true,
+}
+
+// extraArgPattern is what an extra_args key must look like once leading
+// dashes are dropped, so that a value cannot be smuggled in with "=".
+var extraArgPattern = regexp.MustCompile(`^[a-z0-9-]+$`)
+
+// extra_args that would let a request pick its own credentials.
+var credentialArgs = map[string]bool{
+	"cookies":              true,
+	"cookies-from-browser": true,
+	"netrc":                true,
+	"netrc-location":       true,
+	"netrc-cmd":            true,
+	"username":             true,
+	"password":             true,
+	"video-password":       true,
+	"ap-username":          true,
+	"ap-password":          true,
+}
+
+var subtitleConvertFormats = map[string]bool{
+	"srt": true,
+	"vtt": true,
+}
+
+var subtitleExtensions = map[string]bool{
+	".srt":   true,
+	".vtt":   true,
+	".ass":   true,
+	".ssa":   true,
+	".lrc":   true,
+	".ttml":  true,
+	".srv1":  true,
+	".srv2":  true,
+	".srv3":  true,
+	".json3": true,
+}
+
+// args translates the options into yt-dlp command line arguments.
+func (o *Options) args() ([]string, error) {
+	if o == nil {
+		return nil, nil
+	}
+
+	var args []string
+
+	if _, err := parseRate(o.RateLimit); err != nil {
+		return nil, fmt.Errorf("%w: rate_limit: %v", ErrInvalidOptions, err)
+	}
+	if _, ok := o.extraArg("limit-rate"); ok {
+		return nil, fmt.Errorf("%w: use rate_limit instead of extra_args limit-rate", ErrInvalidOptions)
+	}
+
+	selection, err := o.FormatSelection()
+	if err != nil {
+		return nil, err
+	}
+	if selection != nil {
+		args = append(args, selection.args()...)
+	}
+
+	if o.Audio != nil {
+		audioArgs, err := o.Audio.args()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, audioArgs...)
+	} else if o.AudioOnly {
+		args = append(args, "--extract-audio", "--audio-format", "mp3")
+	}
+	if o.MaxFileSize != "" {
+		args = append(args, "--max-filesize", o.MaxFileSize)
+	}
+
+	if o.Subtitles != nil {
+		subtitleArgs, err := o.Subtitles.args()
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, subtitleArgs...)
+	}
+
+	if o.Thumbnail {
+		args = append(args, "--write-thumbnail", "--convert-thumbnails", "jpg")
+	}
+	if o.EmbedThumbnail {
+		args = append(args, "--embed-thumbnail")
+	}
+
+	accessArgs, err := o.accessArgs()
+	if err != nil {
+		return nil, err
+	}
+	return append(args, accessArgs...), nil
+}
+
+// accessArgs returns the extra_args, which metadata runs pass as well as
+// downloads. It also checks that credentials were resolved for
+// credentialArgs.
+func (o *Options) accessArgs() ([]string, error) {
+	if o == nil {
+		return nil, nil
+	}
+	if o.Credentials != "" && o.CredentialProfile == nil {
+		return nil, fmt.Errorf("%w: credential profile %q was not resolved", ErrInvalidOptions, o.Credentials)
+	}
+
+	var args []string
+	for _, key := range slices.Sorted(maps.Keys(o.ExtraArgs)) {
+		name := extraArgName(key)
+		if credentialArgs[name] {
+			return nil, fmt.Errorf("%w: extra_args may not set %s, use credentials instead", ErrInvalidOptions, maskedKey(key))
+		}
+		takesValue, allowed := extraArgFlags[name]
+		if !allowed || !extraArgPattern.MatchString(name) {
+			return nil, fmt.Errorf("%w: extra_args may not set %s", ErrInvalidOptions, maskedKey(key))
+		}
+
+		args = append(args, "--"+name)
+		if takesValue {
+			args = append(args, o.ExtraArgs[key])
+		} else if o.ExtraArgs[key] != "" {
+			return nil, fmt.Errorf("%w: extra_args %s takes no value", ErrInvalidOptions, key)
+		}
+	}
+
+	return args, nil
+}
+
+// extraArgName is the yt-dlp option an extra_args key refers to.
+func extraArgName(key string) string {
+	return strings.TrimLeft(strings.ToLower(key), "-")
+}
+
+// maskedKey hides a value smuggled into an extra_args key with "=", which
+// may hold credentials, so that the key can be logged and stored.
+func maskedKey(key string) string {
+	if i := strings.IndexByte(key, '='); i >= 0 {
+		return key[:i] + "=***"
+	}
+	return key
+}
+
+// Redacted returns a copy of o that is safe to persist: proxy credentials
+// in extra_args are masked.
+func (o *Options) Redacted() *Options {
+	if o == nil {
+		return nil
+	}
+	redacted := *o
+	if len(o.ExtraArgs) > 0 {
+		redacted.ExtraArgs = make(map[string]string, len(o.ExtraArgs))
+		for key, value := range o.ExtraArgs {
+			if name := extraArgName(key); name == "proxy" || name == "geo-verification-proxy" {
+				value = proxy.RedactURL(value)
+			}
+			redacted.ExtraArgs[maskedKey(key)] = value
+		}
+	}
+	return &redacted
+}
+
+// HasRedactedSecrets reports whether o came from Redacted and had secrets
+// masked, so that running it would not use the values originally given.
+func (o *Options) HasRedactedSecrets() bool {
+	if o == nil {
+		return false
+	}
+	for key, value := range o.ExtraArgs {
+		if strings.HasSuffix(key, "=***") {
+			return true
+		}
+		if name := extraArgName(key); (name == "proxy" || name == "geo-verification-proxy") && proxy.IsRedactedURL(value) {
+			return true
+		}
+	}
+	return false
+}
+
+// extraArg looks up name in ExtraArgs, ignoring case and leading dashes.
+func (o *Options) extraArg(name string) (string, bool) {
+	if o == nil {
+		return "", false
+	}
+	for key, value := range o.ExtraArgs {
+		if extraArgName(key) == name {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// credentialArgs points yt-dlp at the resolved credential profile. yt-dlp
+// writes cookie jars back after use, so they are copied into the job dir
+// first; the copy is returned so it can be removed once yt-dlp exits.
+func (o *Options) credentialArgs(dir string) ([]string, string, error) {
+	if o == nil || o.CredentialProfile == nil {
+		return nil, "", nil
+	}
+
+	profile := o.CredentialProfile
+	if profile.NetrcFile != "" {
+		return []string{"--netrc", "--netrc-location", profile.NetrcFile}, "", nil
+	}
+
+	data, err := os.ReadFile(profile.CookiesFile)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to read cookies for credential profile %s", profile.Name)
+	}
+	jar := filepath.Join(dir, cookieJarName)
+	if err := os.WriteFile(jar, data, 0600); err != nil {
+		return nil, "", fmt.Errorf("failed to copy cookies for credential profile %s", profile.Name)
+	}
+	return []string{"--cookies", jar}, jar, nil
+}
+
+func (o *AudioOptions) args() ([]string, error) {
+	codec := strings.ToLower(o.Codec)
+	if codec == "" {
+		codec = "mp3"
+	}
+	if !audioCodecs[codec] {
+		return nil, fmt.Errorf("%w: unsupported audio codec %q, use mp3, m4a, aac, opus, flac or wav", ErrInvalidOptions, o.Codec)
+	}
+
+	args := []string{"--extract-audio", "--audio-format", codec}
+
+	if o.Quality != "" {
+		if !audioQualityPattern.MatchString(o.Quality) {
+			return nil, fmt.Errorf("%w: audio quality must be a VBR level 0-10 or a bitrate like 128K", ErrInvalidOptions)
+		}
+		args = append(args, "--audio-quality", o.Quality)
+		// The processing step re-encodes with the requested quality, which
+		// for opus can only be a bitrate.
+		_, vbr := audioVBRScales[audioEncoders[codec]]
+		if o.reencodes() && !vbr && !losslessAudioCodecs[codec] && !strings.HasSuffix(strings.ToUpper(o.Quality), "K") {
+			return nil, fmt.Errorf("%w: %s audio quality must be a bitrate like 128K with normalize or sample_rate", ErrInvalidOptions, codec)
+		}
+	}
+
+	// Sample rate and normalization are applied by processAudio.
+	if o.SampleRate != 0 && (o.SampleRate < 8000 || o.SampleRate > 192000) {
+		return nil, fmt.Errorf("%w: audio sample rate must be between 8000 and 192000", ErrInvalidOptions)
+	}
+
+	if o.EmbedMetadata {
+		// Fall back to the uploader when the extractor has no artist.
+		args = append(args, "--embed-metadata", "--parse-metadata", "%(artist,uploader)s:%(artist)s")
+		if audioCoverArtCodecs[codec] {
+			args = append(args, "--embed-thumbnail")
+		}
+	}
+
+	return args, nil
+}
+
+func (o *SubtitleOptions) args() ([]string, error) {
+	args := []string{"--write-subs"}
+	if o.AutoGenerated {
+		args = append(args, "--write-auto-subs")
+	}
+
+	languages := o.Languages
+	if len(languages) == 0 {
+		languages = []string{"en"}
+	}
+	args = append(args, "--sub-langs", strings.Join(languages, ","))
+
+	if o.Format != "" {
+		format := strings.ToLower(o.Format)
+		if !subtitleConvertFormats[format] {
+			return nil, fmt.Errorf("%w: unsupported subtitle format %q, use srt or vtt", ErrInvalidOptions, o.Format)
+		}
+		args = append(args, "--convert-subs", format)
+	}
+
+	return args, nil
+}
+
+var thumbnailExtensions = map[string]bool{
+	".jpg":  true,
+	".jpeg": true,
+	".png":  true,
+	".webp": true,
+}
+
+func isThumbnailFile(name string) bool {
+	return thumbnailExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+func isSubtitleFile(name string) bool {
+	return subtitleExtensions[strings.ToLower(filepath.Ext(name))]
+}
+
+// subtitleLanguage extracts the language from yt-dlp's "<title>.<lang>.<ext>"
+// subtitle naming.
+func subtitleLanguage(name string) string {
+	stem := strings.TrimSuffix(name, filepath.Ext(name))
+	return strings.TrimPrefix(filepath.Ext(stem), ".")
+}
@@ -0,0 +1,116 @@
+package ytdlp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	neturl "net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.uber.org/zap"
+)
+
+// Playlist is a channel or playlist listed without resolving its entries.
+type Playlist struct {
+	ID        string          `json:"id"`
+	Title     string          `json:"title"`
+	Uploader  string          `json:"uploader"`
+	Extractor string          `json:"extractor"`
+	Entries   []PlaylistEntry `json:"entries"`
+}
+
+type PlaylistEntry struct {
+	Type  string `json:"_type"`
+	ID    string `json:"id"`
+	URL   string `json:"url"`
+	Title string `json:"title"`
+	IEKey string `json:"ie_key"`
+}
+
+// playlistExtractorSuffixes name the extractors of nested playlists, like
+// YoutubeTab or SoundcloudPlaylist.
+var playlistExtractorSuffixes = []string{"Tab", "Playlist", "Channel", "Album", "User"}
+
+// channelTabs are the last path segments of channel tab URLs.
+var channelTabs = map[string]bool{
+	"videos": true, "shorts": true, "streams": true, "live": true, "playlists": true,
+	"featured": true, "releases": true, "podcasts": true, "community": true,
+}
+
+// IsPlaylist reports whether the entry is a nested playlist, such as a tab of
+// a channel, rather than a video. --flat-playlist reports both with _type
+// "url", so the extractor and URL are checked as well.
+func (e *PlaylistEntry) IsPlaylist() bool {
+	if e.Type == "playlist" {
+		return true
+	}
+	for _, suffix := range playlistExtractorSuffixes {
+		if strings.HasSuffix(e.IEKey, suffix) {
+			return true
+		}
+	}
+	parsed, err := neturl.Parse(e.URL)
+	if err != nil {
+		return false
+	}
+	if parsed.Path == "/playlist" || (parsed.Query().Has("list") && !parsed.Query().Has("v")) {
+		return true
+	}
+	return channelTabs[path.Base(parsed.Path)]
+}
+
+// ListPlaylist lists the entries of a channel or playlist with
+// --flat-playlist, newest first as the site orders them. A limit above zero
+// stops after that many entries. A single video is returned as a playlist of
+// one. Like a download, listing uses the credentials and proxy of options.
+func (s *Service) ListPlaylist(ctx context.Context, url string, limit int, options *Options) (*Playlist, error) {
+	ctx, span := tracer.Start(ctx, "ytdlp.ListPlaylist", trace.WithAttributes(
+		attribute.String("ytdlp.host", hostKey(url)),
+	))
+	playlist, err := s.listPlaylist(ctx, url, limit, options)
+	if playlist != nil {
+		span.SetAttributes(attribute.Int("ytdlp.entries", len(playlist.Entries)))
+	}
+	endSpan(span, err)
+	return playlist, err
+}
+
+func (s *Service) listPlaylist(ctx context.Context, url string, limit int, options *Options) (*Playlist, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("Listing playlist", zap.String("url", url))
+
+	args := []string{"--flat-playlist", "--dump-single-json"}
+	if limit > 0 {
+		args = append(args, "--playlist-end", strconv.Itoa(limit))
+	}
+	output, err := s.runMetadata(ctx, "playlist", url, options, args)
+	if err != nil {
+		logger.Error("Failed to list playlist", zap.Error(err), zap.String("url", url))
+		return nil, err
+	}
+
+	var raw struct {
+		Playlist
+		Type       string `json:"_type"`
+		WebpageURL string `json:"webpage_url"`
+	}
+	if err := json.Unmarshal(output, &raw); err != nil {
+		s.metrics.YtdlpInvocations.WithLabelValues("playlist", "error", "unknown").Inc()
+		logger.Error("Failed to parse playlist", zap.Error(err))
+		return nil, fmt.Errorf("failed to parse playlist: %w", err)
+	}
+	s.metrics.YtdlpInvocations.WithLabelValues("playlist", "success", extractorLabel(&VideoInfo{Extractor: raw.Extractor})).Inc()
+
+	playlist := raw.Playlist
+	if raw.Type != "playlist" {
+		playlist.Entries = []PlaylistEntry{{Type: "video", ID: raw.ID, URL: raw.WebpageURL, Title: raw.Title}}
+	}
+
+	logger.Info("Playlist listed", zap.String("title", playlist.Title), zap.Int("entries", len(playlist.Entries)))
+	return &playlist, nil
+}
@@ -0,0 +1,67 @@
+package ytdlp
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+// channelSample is trimmed output of
+// yt-dlp --flat-playlist --dump-single-json https://www.youtube.com/@example
+// with a channel's tabs, a nested playlist and videos as flat entries.
+const channelSample = `{
+  "id": "UCuAXFkgsw1L7xaCfnd5JJOw",
+  "channel": "Example",
+  "title": "Example",
+  "uploader": "Example",
+  "_type": "playlist",
+  "extractor": "youtube:tab",
+  "extractor_key": "YoutubeTab",
+  "webpage_url": "https://www.youtube.com/@example",
+  "entries": [
+    {"_type": "url", "ie_key": "YoutubeTab", "id": "UCuAXFkgsw1L7xaCfnd5JJOw", "url": "https://www.youtube.com/@example/videos", "title": "Example - Videos"},
+    {"_type": "url", "ie_key": "YoutubeTab", "id": "UCuAXFkgsw1L7xaCfnd5JJOw", "url": "https://www.youtube.com/@example/shorts", "title": "Example - Shorts"},
+    {"_type": "url", "ie_key": "YoutubeTab", "id": "PLbpi6ZahtOH6Blw3RGYpWkSByi_T7Rygb", "url": "https://www.youtube.com/playlist?list=PLbpi6ZahtOH6Blw3RGYpWkSByi_T7Rygb", "title": "Uploads"},
+    {"_type": "url", "ie_key": "Youtube", "id": "dQw4w9WgXcQ", "url": "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "title": "A video", "duration": 212.0, "view_count": 1000},
+    {"_type": "url", "ie_key": "Youtube", "id": "jNQXAC9IVRw", "url": "https://www.youtube.com/shorts/jNQXAC9IVRw", "title": "A short"},
+    {"_type": "url", "ie_key": "Youtube", "id": "9bZkp7q19f0", "url": "https://www.youtube.com/watch?v=9bZkp7q19f0&list=PLbpi6ZahtOH6Blw3RGYpWkSByi_T7Rygb", "title": "A video in a playlist"}
+  ]
+}`
+
+func TestPlaylistEntryIsPlaylist(t *testing.T) {
+	var playlist Playlist
+	if err := json.Unmarshal([]byte(channelSample), &playlist); err != nil {
+		t.Fatal(err)
+	}
+
+	var videos []string
+	for _, entry := range playlist.Entries {
+		if !entry.IsPlaylist() {
+			videos = append(videos, entry.ID)
+		}
+	}
+	want := []string{"dQw4w9WgXcQ", "jNQXAC9IVRw", "9bZkp7q19f0"}
+	if !slices.Equal(videos, want) {
+		t.Errorf("videos = %v, want %v", videos, want)
+	}
+}
+
+func TestPlaylistEntryIsPlaylistByURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		want bool
+	}{
+		{"https://www.youtube.com/@example/streams", true},
+		{"https://www.youtube.com/channel/UCuAXFkgsw1L7xaCfnd5JJOw/playlists", true},
+		{"https://www.youtube.com/playlist?list=PL123", true},
+		{"https://www.youtube.com/watch?v=abc", false},
+		{"https://vimeo.com/123456", false},
+		{"https://www.twitch.tv/videos/123456", false},
+	}
+	for _, tt := range tests {
+		entry := PlaylistEntry{Type: "url", URL: tt.url}
+		if got := entry.IsPlaylist(); got != tt.want {
+			t.Errorf("IsPlaylist(%s) = %v, want %v", tt.url, got, tt.want)
+		}
+	}
+}
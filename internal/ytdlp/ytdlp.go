@@ -1,98 +1,449 @@
 package ytdlp
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
+	"github.com/callmemars1/ytdlp-http/internal/configurations"
+	"github.com/callmemars1/ytdlp-http/internal/logging"
+	"github.com/callmemars1/ytdlp-http/internal/metrics"
+	"github.com/callmemars1/ytdlp-http/internal/proxy"
+	"github.com/callmemars1/ytdlp-http/internal/retry"
+	"github.com/callmemars1/ytdlp-http/internal/tracing"
+	"github.com/callmemars1/ytdlp-http/internal/utils"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 	"go.uber.org/zap"
 )
 
+var tracer = otel.Tracer("github.com/callmemars1/ytdlp-http/internal/ytdlp")
+
+var (
+	ErrShuttingDown   = errors.New("service is shutting down")
+	ErrInvalidOptions = errors.New("invalid options")
+)
+
 type Service struct {
-	logger *zap.Logger
-	mu     sync.Mutex
-	tmpDir string
+	config  *configurations.YtdlpConfig
+	logger  *zap.Logger
+	metrics *metrics.Metrics
+	proxies *proxy.Manager
+	limiter *limiter
+	tmpDir  string
+
+	// budget is the global bandwidth budget in bytes per second, 0 if
+	// unlimited. It is shared by the downloads running when each starts.
+	budget      int64
+	downloading atomic.Int64
+
+	stopJanitor context.CancelFunc
+
+	jobsMu  sync.Mutex
+	jobs    map[string]struct{}
+	jobsWG  sync.WaitGroup
+	closing bool
 }
 
 type VideoInfo struct {
-	ID          string  `json:"id"`
-	Title       string  `json:"title"`
-	Duration    float64 `json:"duration"`
-	Uploader    string  `json:"uploader"`
-	UploadDate  string  `json:"upload_date"`
-	ViewCount   int64   `json:"view_count"`
-	Format      string  `json:"format"`
-	Filename    string  `json:"filename"`
-	Filesize    int64   `json:"filesize"`
-	URL         string  `json:"url"`
-	Thumbnail   string  `json:"thumbnail"`
-	Description string  `json:"description"`
-}
-
-type Options struct {
-	Format      string            `json:"format,omitempty"`
-	AudioOnly   bool              `json:"audio_only,omitempty"`
-	VideoOnly   bool              `json:"video_only,omitempty"`
-	Quality     string            `json:"quality,omitempty"`
-	OutputPath  string            `json:"output_path,omitempty"`
-	ExtraArgs   map[string]string `json:"extra_args,omitempty"`
-	MaxFileSize string            `json:"max_file_size,omitempty"`
-}
-
-func NewService(logger *zap.Logger) *Service {
-	tmpDir := filepath.Join(os.TempDir(), "ytdlp-downloads")
+	ID           string    `json:"id"`
+	Title        string    `json:"title"`
+	Duration     float64   `json:"duration"`
+	Uploader     string    `json:"uploader"`
+	UploadDate   string    `json:"upload_date"`
+	ViewCount    int64     `json:"view_count"`
+	Format       string    `json:"format"`
+	Filename     string    `json:"filename"`
+	Filesize     int64     `json:"filesize"`
+	URL          string    `json:"url"`
+	Thumbnail    string    `json:"thumbnail"`
+	Description  string    `json:"description"`
+	Extractor    string    `json:"extractor"`
+	ExtractorKey string    `json:"extractor_key"`
+	WebpageURL   string    `json:"webpage_url"`
+	ChannelID    string    `json:"channel_id"`
+	LikeCount    int64     `json:"like_count"`
+	LiveStatus   string    `json:"live_status"`
+	AgeLimit     int       `json:"age_limit"`
+	Tags         []string  `json:"tags"`
+	Categories   []string  `json:"categories"`
+	Chapters     []Chapter `json:"chapters"`
+	Width        int       `json:"width"`
+	Height       int       `json:"height"`
+	FPS          float64   `json:"fps"`
+	VCodec       string    `json:"vcodec"`
+	ACodec       string    `json:"acodec"`
+
+	// RawInfo is the yt-dlp info JSON, only kept when Options.IncludeRawInfo
+	// is set. Request cookies and headers are stripped; see stripRawInfo.
+	RawInfo json.RawMessage `json:"raw_info,omitempty"`
+}
+
+// ArchiveEntry is the video's line in a yt-dlp download archive, or empty if
+// the info lacks the extractor or ID.
+func (i *VideoInfo) ArchiveEntry() string {
+	if i == nil || i.ExtractorKey == "" || i.ID == "" {
+		return ""
+	}
+	return strings.ToLower(i.ExtractorKey) + " " + i.ID
+}
+
+// rawInfoSecrets are keys yt-dlp writes into the info JSON, and into each of
+// its formats, that carry the session cookies and headers of the request.
+var rawInfoSecrets = []string{"cookies", "http_headers"}
+
+// stripRawInfo removes rawInfoSecrets from every object in an info JSON, so
+// a credential profile's session never ends up in a response or on S3.
+func stripRawInfo(data []byte) (json.RawMessage, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var info any
+	if err := decoder.Decode(&info); err != nil {
+		return nil, err
+	}
+	stripSecrets(info)
+	return json.Marshal(info)
+}
+
+func stripSecrets(value any) {
+	switch value := value.(type) {
+	case map[string]any:
+		for _, key := range rawInfoSecrets {
+			delete(value, key)
+		}
+		for _, nested := range value {
+			stripSecrets(nested)
+		}
+	case []any:
+		for _, nested := range value {
+			stripSecrets(nested)
+		}
+	}
+}
+
+type Chapter struct {
+	StartTime float64 `json:"start_time"`
+	EndTime   float64 `json:"end_time"`
+	Title     string  `json:"title"`
+}
+
+// DownloadResult describes the files produced by a single DownloadVideo call.
+// All of them live in one job directory released by CleanupFile(FilePath).
+type DownloadResult struct {
+	FilePath      string
+	Info          *VideoInfo
+	Format        *FormatSelection
+	Subtitles     []SubtitleFile
+	ThumbnailPath string
+
+	// Attempts is the number of yt-dlp runs it took, including retries.
+	Attempts int
+}
+
+type SubtitleFile struct {
+	Language string
+	Path     string
+}
+
+func NewService(cfg *configurations.YtdlpConfig, logger *zap.Logger, m *metrics.Metrics, proxies *proxy.Manager) *Service {
+	tmpDir := cfg.TempDir
+	if tmpDir == "" {
+		tmpDir = filepath.Join(os.TempDir(), "ytdlp-downloads")
+	}
 	if err := os.MkdirAll(tmpDir, 0755); err != nil {
 		logger.Fatal("Failed to create temp directory", zap.Error(err))
 	}
 
+	m.RegisterGaugeFunc("temp_dir_bytes", "Disk usage of the yt-dlp temp download directory.", func() float64 {
+		size, err := utils.DirSize(tmpDir)
+		if err != nil {
+			logger.Warn("Failed to measure temp directory size", zap.Error(err))
+		}
+		return float64(size)
+	})
+
+	budget, err := parseRate(cfg.RateLimit)
+	if err != nil {
+		logger.Fatal("Invalid YTDLP_RATE_LIMIT", zap.Error(err))
+	}
 	return &Service{
-		logger: logger,
-		tmpDir: tmpDir,
+		config:  cfg,
+		logger:  logger,
+		metrics: m,
+		proxies: proxies,
+		limiter: newLimiter(cfg.Concurrency, cfg.MaxPerHost),
+		tmpDir:  tmpDir,
+		budget:  budget,
+		jobs:    make(map[string]struct{}),
 	}
 }
 
-func (s *Service) GetVideoInfo(ctx context.Context, url string) (*VideoInfo, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// Shutdown refuses new downloads, waits for in-flight jobs to release their
+// download directories until ctx is done, then removes everything left in
+// the temp dir.
+func (s *Service) Shutdown(ctx context.Context) error {
+	if s.stopJanitor != nil {
+		s.stopJanitor()
+	}
+
+	s.jobsMu.Lock()
+	s.closing = true
+	active := len(s.jobs)
+	s.jobsMu.Unlock()
 
-	s.logger.Info("Getting video info", zap.String("url", url))
+	if active > 0 {
+		s.logger.Info("Waiting for active download jobs", zap.Int("jobs", active))
+	}
 
-	cmd := exec.CommandContext(ctx, "yt-dlp", 
-		"--dump-json", 
-		"--no-playlist", 
-		url)
-	
-	output, err := cmd.Output()
+	done := make(chan struct{})
+	go func() {
+		s.jobsWG.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-ctx.Done():
+		s.logger.Warn("Timed out waiting for download jobs, removing their files", zap.Error(ctx.Err()))
+	}
+
+	return s.sweep()
+}
+
+// startJob registers dir as owned by an in-flight job.
+func (s *Service) startJob(dir string) error {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	if s.closing {
+		return ErrShuttingDown
+	}
+	s.jobs[dir] = struct{}{}
+	s.jobsWG.Add(1)
+	return nil
+}
+
+func (s *Service) isActiveJob(dir string) bool {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	_, ok := s.jobs[dir]
+	return ok
+}
+
+func (s *Service) finishJob(dir string) {
+	s.jobsMu.Lock()
+	defer s.jobsMu.Unlock()
+
+	if _, ok := s.jobs[dir]; ok {
+		delete(s.jobs, dir)
+		s.jobsWG.Done()
+	}
+}
+
+func (s *Service) TempDir() string {
+	return s.tmpDir
+}
+
+// acquire waits for a yt-dlp worker slot for url and returns its release func.
+func (s *Service) acquire(ctx context.Context, url string) (func(), error) {
+	_, span := tracer.Start(ctx, "ytdlp.queue")
+	s.metrics.QueueDepth.Inc()
+	release, err := s.limiter.acquire(ctx, hostKey(url))
+	s.metrics.QueueDepth.Dec()
+	tracing.End(span, err)
 	if err != nil {
-		s.logger.Error("Failed to get video info", zap.Error(err), zap.String("url", url))
-		return nil, fmt.Errorf("failed to get video info: %w", err)
+		return nil, err
+	}
+	s.metrics.ActiveWorkers.Inc()
+
+	return func() {
+		s.metrics.ActiveWorkers.Dec()
+		release()
+	}, nil
+}
+
+// rateLimitArgs returns --limit-rate for the lower of the request's limit and
+// an even share of the global budget among the running downloads, including
+// this one. A yt-dlp run keeps its rate, so the share is fixed when it starts.
+func (s *Service) rateLimitArgs(options *Options, running int64) []string {
+	var rate int64
+	if s.budget > 0 {
+		rate = s.budget / max(running, 1)
+	}
+	if options != nil {
+		// Already validated by options.args.
+		requested, _ := parseRate(options.RateLimit)
+		if requested > 0 && (rate == 0 || requested < rate) {
+			rate = requested
+		}
+	}
+	if rate == 0 {
+		return nil
+	}
+	return []string{"--limit-rate", strconv.FormatInt(rate, 10)}
+}
+
+// GetVideoInfo fetches url's metadata without downloading it, reaching it the
+// way DownloadVideo would with options.
+func (s *Service) GetVideoInfo(ctx context.Context, url string, options *Options) (*VideoInfo, error) {
+	ctx, span := tracer.Start(ctx, "ytdlp.GetVideoInfo", trace.WithAttributes(
+		attribute.String("ytdlp.host", hostKey(url)),
+	))
+	info, err := s.getVideoInfo(ctx, url, options)
+	endSpan(span, err)
+	return info, err
+}
+
+func (s *Service) getVideoInfo(ctx context.Context, url string, options *Options) (*VideoInfo, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	logger.Info("Getting video info", zap.String("url", url))
+
+	output, err := s.runMetadata(ctx, "info", url, options, []string{"--dump-json", "--no-playlist"})
+	if err != nil {
+		logger.Error("Failed to get video info", zap.Error(err), zap.String("url", url))
+		return nil, err
 	}
 
 	var info VideoInfo
 	if err := json.Unmarshal(output, &info); err != nil {
-		s.logger.Error("Failed to parse video info", zap.Error(err))
+		s.metrics.YtdlpInvocations.WithLabelValues("info", "error", "unknown").Inc()
+		logger.Error("Failed to parse video info", zap.Error(err))
 		return nil, fmt.Errorf("failed to parse video info: %w", err)
 	}
+	s.metrics.YtdlpInvocations.WithLabelValues("info", "success", extractorLabel(&info)).Inc()
 
-	s.logger.Info("Video info retrieved", zap.String("title", info.Title), zap.String("id", info.ID))
+	logger.Info("Video info retrieved", zap.String("title", info.Title), zap.String("id", info.ID))
 	return &info, nil
 }
 
-func (s *Service) DownloadVideo(ctx context.Context, url string, options *Options) (string, *VideoInfo, error) {
-	s.mu.Lock()
-	defer s.mu.Unlock()
+// runMetadata runs yt-dlp with args, which print JSON about url instead of
+// downloading it, and returns its stdout. Like a download with options, it
+// uses their credential profile, extra_args and proxy pool.
+func (s *Service) runMetadata(ctx context.Context, label, url string, options *Options, args []string) ([]byte, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	accessArgs, err := options.accessArgs()
+	if err != nil {
+		return nil, err
+	}
+	var poolName string
+	if options != nil {
+		poolName = options.ProxyPool
+	}
+	if err := s.proxies.Validate(poolName); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOptions, err)
+	}
 
-	s.logger.Info("Starting video download", zap.String("url", url))
+	release, err := s.acquire(ctx, url)
+	if err != nil {
+		return nil, err
+	}
+	defer release()
 
-	uniqueDir := filepath.Join(s.tmpDir, fmt.Sprintf("download_%d", time.Now().UnixNano()))
-	if err := os.MkdirAll(uniqueDir, 0755); err != nil {
-		return "", nil, fmt.Errorf("failed to create download directory: %w", err)
+	// The job dir only holds the copy of a cookie jar.
+	dir, err := s.newJobDir()
+	if err != nil {
+		return nil, err
+	}
+	defer s.discard(dir)
+	authArgs, _, err := options.credentialArgs(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	args = append(args, accessArgs...)
+	args = append(args, authArgs...)
+	var selected *proxy.Proxy
+	if _, explicitProxy := options.extraArg("proxy"); !explicitProxy {
+		selected, err = s.proxies.Pick(poolName, url)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, proxyArgs(selected)...)
+	}
+	args = append(args, url)
+	logCommand(logger, args)
+
+	execCtx, span := startExec(ctx, args, 1)
+	cmd := exec.CommandContext(execCtx, "yt-dlp", args...)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	tracing.End(span, err)
+	s.proxies.Report(selected, stderr.String(), err)
+	if err != nil {
+		s.metrics.YtdlpInvocations.WithLabelValues(label, "error", "unknown").Inc()
+		return nil, classify(ctx, redactOutput(stderr.String(), args), err)
+	}
+	return output, nil
+}
+
+// newJobDir creates a directory under the temp dir that the janitor leaves
+// alone until it is discarded.
+func (s *Service) newJobDir() (string, error) {
+	dir := filepath.Join(s.tmpDir, fmt.Sprintf("%s%d", downloadDirPrefix, time.Now().UnixNano()))
+	if err := s.startJob(dir); err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		s.finishJob(dir)
+		return "", fmt.Errorf("failed to create download directory: %w", err)
+	}
+	return dir, nil
+}
+
+func (s *Service) DownloadVideo(ctx context.Context, url string, options *Options) (*DownloadResult, error) {
+	ctx, span := tracer.Start(ctx, "ytdlp.DownloadVideo", trace.WithAttributes(
+		attribute.String("ytdlp.host", hostKey(url)),
+	))
+	result, err := s.downloadVideo(ctx, url, options)
+	if result != nil {
+		span.SetAttributes(attribute.Int("ytdlp.attempts", result.Attempts))
+	}
+	endSpan(span, err)
+	return result, err
+}
+
+func (s *Service) downloadVideo(ctx context.Context, url string, options *Options) (*DownloadResult, error) {
+	logger := logging.FromContext(ctx, s.logger)
+	optionArgs, err := options.args()
+	if err != nil {
+		return nil, err
+	}
+	var poolName string
+	if options != nil {
+		poolName = options.ProxyPool
+	}
+	if err := s.proxies.Validate(poolName); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidOptions, err)
+	}
+
+	logger.Info("Starting video download", zap.String("url", url))
+	if options != nil && options.CredentialProfile != nil {
+		logger.Info("Using credential profile", zap.String("profile", options.CredentialProfile.Name))
+	}
+
+	uniqueDir, err := s.newJobDir()
+	if err != nil {
+		return nil, err
+	}
+
+	authArgs, cookieJar, err := options.credentialArgs(uniqueDir)
+	if err != nil {
+		s.discard(uniqueDir)
+		return nil, err
 	}
 
 	args := []string{
@@ -100,81 +451,159 @@ func (s *Service) DownloadVideo(ctx context.Context, url string, options *Option
 		"--output", filepath.Join(uniqueDir, "%(title)s.%(ext)s"),
 		"--write-info-json",
 	}
+	args = append(args, optionArgs...)
+	args = append(args, authArgs...)
 
-	if options != nil {
-		if options.Format != "" {
-			args = append(args, "--format", options.Format)
-		}
-		if options.AudioOnly {
-			args = append(args, "--extract-audio", "--audio-format", "mp3")
-		}
-		if options.VideoOnly {
-			args = append(args, "--format", "best[height<=720]")
-		}
-		if options.Quality != "" {
-			args = append(args, "--format", fmt.Sprintf("best[height<=%s]", options.Quality))
+	// An explicit --proxy in extra_args takes precedence over the pools.
+	_, explicitProxy := options.extraArg("proxy")
+	var (
+		selected *proxy.Proxy
+		runArgs  []string
+		output   []byte
+	)
+	attempts, err := retry.Do(ctx, s.retryPolicy(), isTransient, func(attempt int, delay time.Duration, err error) {
+		logger.Warn("Retrying yt-dlp download", 
+			zap.String("url", url),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", delay),
+			zap.Error(err))
+	}, func(attempt int) error {
+		// Slots are held per attempt, so that backoff between attempts
+		// leaves them to other jobs.
+		release, err := s.acquire(ctx, url)
+		if err != nil {
+			return err
 		}
-		if options.MaxFileSize != "" {
-			args = append(args, "--max-filesize", options.MaxFileSize)
+		defer release()
+
+		running := s.downloading.Add(1)
+		defer s.downloading.Add(-1)
+		runArgs = append([]string(nil), args...)
+		runArgs = append(runArgs, s.rateLimitArgs(options, running)...)
+		// Pick again on every attempt so a retry can move to another proxy.
+		selected = nil
+		if !explicitProxy {
+			selected, err = s.proxies.Pick(poolName, url)
+			if err != nil {
+				return err
+			}
+			runArgs = append(runArgs, proxyArgs(selected)...)
 		}
-		
-		for key, value := range options.ExtraArgs {
-			args = append(args, fmt.Sprintf("--%s", key), value)
+		runArgs = append(runArgs, url)
+		logCommand(logger, runArgs)
+
+		execCtx, span := startExec(ctx, runArgs, attempt)
+		cmd := exec.CommandContext(execCtx, "yt-dlp", runArgs...)
+		started := time.Now()
+		output, err = cmd.CombinedOutput()
+		s.metrics.DownloadDuration.Observe(time.Since(started).Seconds())
+		s.proxies.Report(selected, string(output), err)
+		if err != nil {
+			s.metrics.YtdlpInvocations.WithLabelValues("download", "error", "unknown").Inc()
+			classified := classify(ctx, redactOutput(string(output), runArgs), err)
+			endSpan(span, classified)
+			return classified
 		}
+		span.End()
+		return nil
+	})
+	if cookieJar != "" {
+		os.Remove(cookieJar)
 	}
-
-	args = append(args, url)
-
-	cmd := exec.CommandContext(ctx, "yt-dlp", args...)
-	output, err := cmd.CombinedOutput()
 	if err != nil {
-		s.logger.Error("Failed to download video", 
-			zap.Error(err), 
+		s.discard(uniqueDir)
+		var classified *Error
+		if !errors.As(err, &classified) {
+			return nil, err
+		}
+		classified.Attempts = attempts
+		logger.Error("Failed to download video", 
+			zap.Error(classified.Err), 
 			zap.String("url", url),
-			zap.String("yt_dlp_output", string(output)))
-		os.RemoveAll(uniqueDir)
-		return "", nil, fmt.Errorf("failed to download video: %w - output: %s", err, string(output))
+			zap.String("error_code", string(classified.Code)),
+			zap.Int("attempts", attempts),
+			zap.String("yt_dlp_output", classified.Output))
+		return nil, classified
 	}
 
 	files, err := os.ReadDir(uniqueDir)
 	if err != nil {
-		os.RemoveAll(uniqueDir)
-		return "", nil, fmt.Errorf("failed to read download directory: %w", err)
+		s.discard(uniqueDir)
+		return nil, fmt.Errorf("failed to read download directory: %w", err)
 	}
 
-	var videoFile, infoFile string
+	// Already validated by options.args above.
+	selection, _ := options.FormatSelection()
+	result := &DownloadResult{Format: selection, Attempts: attempts}
+	var infoFile string
 	for _, file := range files {
-		if filepath.Ext(file.Name()) == ".json" {
-			infoFile = filepath.Join(uniqueDir, file.Name())
-		} else if !file.IsDir() {
-			videoFile = filepath.Join(uniqueDir, file.Name())
+		if file.IsDir() {
+			continue
+		}
+		path := filepath.Join(uniqueDir, file.Name())
+		switch {
+		case filepath.Ext(file.Name()) == ".json":
+			infoFile = path
+		case isThumbnailFile(file.Name()):
+			result.ThumbnailPath = path
+		case isSubtitleFile(file.Name()):
+			result.Subtitles = append(result.Subtitles, SubtitleFile{
+				Language: subtitleLanguage(file.Name()),
+				Path:     path,
+			})
+		default:
+			result.FilePath = path
+		}
+	}
+
+	if result.FilePath == "" {
+		s.discard(uniqueDir)
+		// yt-dlp exits successfully when it skips a download, e.g. for
+		// --max-filesize, so look at its output for the reason.
+		classified := classify(ctx, redactOutput(string(output), runArgs), errors.New("video file not found after download"))
+		if classified.Code == CodeDownloadFailed {
+			classified.Message = "Video file not found after download"
 		}
+		classified.Attempts = attempts
+		return nil, classified
 	}
 
-	if videoFile == "" {
-		os.RemoveAll(uniqueDir)
-		return "", nil, fmt.Errorf("video file not found after download")
+	if options != nil && options.Audio.reencodes() {
+		if err := s.processAudio(ctx, result.FilePath, options.Audio); err != nil {
+			s.discard(uniqueDir)
+			return nil, err
+		}
 	}
 
-	var info *VideoInfo
 	if infoFile != "" {
 		infoData, err := os.ReadFile(infoFile)
 		if err != nil {
-			s.logger.Warn("Failed to read info file", zap.Error(err))
+			logger.Warn("Failed to read info file", zap.Error(err))
 		} else {
-			info = &VideoInfo{}
-			if err := json.Unmarshal(infoData, info); err != nil {
-				s.logger.Warn("Failed to parse info file", zap.Error(err))
-				info = nil
+			result.Info = &VideoInfo{}
+			if err := json.Unmarshal(infoData, result.Info); err != nil {
+				logger.Warn("Failed to parse info file", zap.Error(err))
+				result.Info = nil
+			} else if options != nil && options.IncludeRawInfo {
+				if result.Info.RawInfo, err = stripRawInfo(infoData); err != nil {
+					logger.Warn("Failed to strip raw info", zap.Error(err))
+				}
 			}
 		}
 	}
 
-	s.logger.Info("Video downloaded successfully", 
-		zap.String("file", videoFile), 
+	s.metrics.YtdlpInvocations.WithLabelValues("download", "success", extractorLabel(result.Info)).Inc()
+	if stat, err := os.Stat(result.FilePath); err == nil {
+		s.metrics.DownloadBytes.Add(float64(stat.Size()))
+	}
+
+	logger.Info("Video downloaded successfully", 
+		zap.String("file", result.FilePath), 
+		zap.Int("subtitles", len(result.Subtitles)),
+		zap.Int("attempts", attempts),
 		zap.String("url", url))
 
-	return videoFile, info, nil
+	return result, nil
 }
 
 func (s *Service) GetVideoReader(filePath string) (io.ReadCloser, int64, error) {
@@ -194,10 +623,123 @@ func (s *Service) GetVideoReader(filePath string) (io.ReadCloser, int64, error)
 
 func (s *Service) CleanupFile(filePath string) error {
 	dir := filepath.Dir(filePath)
+	defer s.finishJob(dir)
 	if err := os.RemoveAll(dir); err != nil {
 		s.logger.Error("Failed to cleanup download directory", zap.Error(err), zap.String("path", dir))
 		return err
 	}
 	s.logger.Debug("Cleaned up download directory", zap.String("path", dir))
 	return nil
-}
\ No newline at end of file
+}
+
+// discard removes a failed job's download directory and releases it.
+func (s *Service) discard(dir string) {
+	os.RemoveAll(dir)
+	s.finishJob(dir)
+}
+
+// logCommand logs a yt-dlp invocation with proxy credentials and credential
+// profile paths redacted.
+func logCommand(logger *zap.Logger, args []string) {
+	if ce := logger.Check(zap.DebugLevel, "Running yt-dlp"); ce != nil {
+		ce.Write(zap.Strings("args", redactArgs(args)))
+	}
+}
+
+func redactArgs(args []string) []string {
+	redacted := make([]string, len(args))
+	for i, arg := range args {
+		if name, value, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(name, "--") {
+			arg = name + "=" + redactArg(name, value)
+		} else if i > 0 {
+			arg = redactArg(args[i-1], arg)
+		}
+		redacted[i] = arg
+	}
+	return redacted
+}
+
+// redactArg redacts the value of flag.
+func redactArg(flag, value string) string {
+	switch {
+	case isProxyFlag(flag):
+		return proxy.RedactURL(value)
+	case flag == "--cookies", flag == "--netrc-location":
+		return "***"
+	}
+	return value
+}
+
+// redactOutput masks every proxy in args, whether picked from a pool or
+// given in extra_args, and its password in yt-dlp output.
+func redactOutput(output string, args []string) string {
+	for i, arg := range args {
+		if name, value, ok := strings.Cut(arg, "="); ok && isProxyFlag(name) {
+			output = proxy.RedactIn(output, value)
+		} else if i > 0 && isProxyFlag(args[i-1]) {
+			output = proxy.RedactIn(output, arg)
+		}
+	}
+	return output
+}
+
+func isProxyFlag(flag string) bool {
+	return flag == "--proxy" || flag == "--geo-verification-proxy"
+}
+
+// argFlags returns the flag names of a yt-dlp invocation, without their
+// values or the source URL.
+func argFlags(args []string) []string {
+	var flags []string
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			name, _, _ := strings.Cut(arg, "=")
+			flags = append(flags, name)
+		}
+	}
+	return flags
+}
+
+// startExec starts the span for a single yt-dlp run. The span's context is
+// only used for the process itself; errors are classified against the parent.
+// Only flag names are exported, as values hold paths, proxies and the URL.
+func startExec(ctx context.Context, args []string, attempt int) (context.Context, trace.Span) {
+	return tracer.Start(ctx, "ytdlp.exec", trace.WithAttributes(
+		attribute.StringSlice("ytdlp.flags", argFlags(args)),
+		attribute.Int("ytdlp.attempt", attempt),
+	))
+}
+
+// endSpan ends span, tagging it with the error code of a classified failure.
+func endSpan(span trace.Span, err error) {
+	var ytdlpErr *Error
+	if errors.As(err, &ytdlpErr) {
+		span.SetAttributes(attribute.String("ytdlp.error_code", string(ytdlpErr.Code)))
+	}
+	tracing.End(span, err)
+}
+
+// maxRetryBackoff caps the wait between yt-dlp attempts.
+const maxRetryBackoff = 30 * time.Second
+
+func (s *Service) retryPolicy() retry.Policy {
+	return retry.Policy{
+		MaxAttempts:    s.config.RetryAttempts,
+		InitialBackoff: s.config.RetryBackoff,
+		MaxBackoff:     maxRetryBackoff,
+	}
+}
+
+func proxyArgs(selected *proxy.Proxy) []string {
+	if selected == nil {
+		return nil
+	}
+	return []string{"--proxy", selected.URL}
+}
+
+func extractorLabel(info *VideoInfo) string {
+	if info == nil || info.Extractor == "" {
+		return "unknown"
+	}
+	return info.Extractor
+}